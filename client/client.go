@@ -1,84 +1,195 @@
 package client
 
 import (
+	"crypto/tls"
 	"fmt"
+	"sync"
+	"time"
+)
 
-	mqtt "github.com/eclipse/paho.mqtt.golang"
+const (
+	PROTOCOL_VERSION_31  = 3
+	PROTOCOL_VERSION_311 = 4
+	PROTOCOL_VERSION_5   = 5
 )
 
+// received message. The properties are only set by MQTT v5 brokers
+type Message struct {
+	Topic           string
+	Payload         []byte
+	ResponseTopic   string
+	CorrelationData []byte
+	UserProperties  map[string]string
+}
+
+type MessageHandler func(msg *Message)
+
+// MQTT v5 properties of a published message, ignored for older protocol versions
+type PublishProperties struct {
+	CorrelationData []byte            `json:"correlationData,omitempty"`
+	UserProperties  map[string]string `json:"userProperties,omitempty"`
+	MessageExpiry   uint32            `json:"messageExpiry,omitempty"` //seconds, 0 never expires
+}
+
 type Topic struct {
 	Topic string
-	Cb    mqtt.MessageHandler
+	Qos   byte
+	Cb    MessageHandler
 }
 
-var topicList []Topic
+type ClientConfig struct {
+	Broker          string
+	ClientId        string
+	Username        string
+	Password        string
+	ProtocolVersion uint        //3 (3.1), 4 (3.1.1) or 5, default 4
+	Tls             *tls.Config //only needed for tls brokers, may be nil
+	Presence        *Presence   //online/offline status of the instance, may be nil
+}
+
+// protocol specific part of the client
+type connection interface {
+	connect() error
+	disconnect()
+	isConnected() bool
+	// publish and wait up to PUBLISH_TIMEOUT for the broker
+	publish(topic string, payload []byte, qos byte, retain bool, props *PublishProperties) error
+	subscribe(topic string, qos byte, callback MessageHandler) error
+}
 
 type MqttClient struct {
-	client mqtt.Client
-}
-
-// var messagePubHandler mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Message) {
-// 	fmt.Printf("Received message: %s from topic: %s\n", msg.Payload(), msg.Topic())
-// }
-
-func NewMqttClientWithConfig(broker string, clientId string, username string, password string) *MqttClient {
-	topicList = make([]Topic, 0)
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(broker)
-	opts.SetClientID(clientId)
-	opts.SetUsername(username)
-	opts.SetPassword(password)
-	// opts.SetDefaultPublishHandler(messagePubHandler)
-
-	opts.SetConnectRetry(true)
-	opts.SetAutoReconnect(true)
-	opts.SetResumeSubs(true)
-
-	opts.SetOnConnectHandler(func(client mqtt.Client) {
-		for _, topic := range topicList {
-			token := client.Subscribe(topic.Topic, 2, topic.Cb)
-			token.Wait()
+	conn     connection
+	outbox   *Outbox
+	presence *Presence
+
+	topicLock sync.Mutex
+	topics    []Topic
+}
+
+func NewMqttClientWithConfig(cfg ClientConfig) (*MqttClient, error) {
+	m := &MqttClient{
+		presence: cfg.Presence,
+		topics:   make([]Topic, 0),
+	}
+
+	switch cfg.ProtocolVersion {
+	case 0, PROTOCOL_VERSION_31, PROTOCOL_VERSION_311:
+		m.conn = newConnectionV3(cfg, m.onConnect)
+	case PROTOCOL_VERSION_5:
+		conn, err := newConnectionV5(cfg, m.onConnect)
+		if err != nil {
+			return nil, err
+		}
+		m.conn = conn
+	default:
+		return nil, fmt.Errorf("unsupported mqtt protocol version %d", cfg.ProtocolVersion)
+	}
+
+	return m, nil
+}
+
+// called after every (re)connect
+func (m *MqttClient) onConnect() {
+	m.topicLock.Lock()
+	topics := append([]Topic{}, m.topics...)
+	m.topicLock.Unlock()
+
+	for _, topic := range topics {
+		if err := m.conn.subscribe(topic.Topic, topic.Qos, topic.Cb); err != nil {
+			fmt.Printf("could not subscribe to %s: %v\n", topic.Topic, err)
 		}
-	})
+	}
 
-	opts.OnConnectionLost = func(client mqtt.Client, err error) {
-		fmt.Printf("Connection lost: %v", err)
+	if m.presence != nil {
+		m.presence.publishOnline(m.conn)
 	}
-	opts.OnReconnecting = func(client mqtt.Client, options *mqtt.ClientOptions) {
-		fmt.Printf("Reconnecting:\n")
+
+	if m.outbox != nil {
+		go m.outbox.flush(m.conn)
 	}
+}
 
-	client := mqtt.NewClient(opts)
+// buffer messages sent with PublishQueued in the outbox while the broker is not reachable.
+// Must be called before Connect
+func (m *MqttClient) SetOutbox(outbox *Outbox) {
+	m.outbox = outbox
+
+	//messages queued while connected are sent with the next publish, this covers
+	//the case that nothing else is published
+	go func() {
+		ticker := time.NewTicker(OUTBOX_RETRY_INTERVAL)
+		for range ticker.C {
+			if m.conn.isConnected() {
+				outbox.flush(m.conn)
+			}
+		}
+	}()
+}
 
-	return &MqttClient{
-		client: client,
+// returns the number of queued, dropped and replayed messages of the outbox
+func (m *MqttClient) OutboxStats() OutboxStats {
+	if m.outbox == nil {
+		return OutboxStats{}
 	}
+
+	return m.outbox.Stats()
 }
 
 // connect to mqtt
 func (m *MqttClient) Connect() error {
-	if token := m.client.Connect(); token.Wait() && token.Error() != nil {
-		return token.Error()
-	}
-	return nil
+	return m.conn.connect()
 }
 
 func (m *MqttClient) IsConnected() bool {
-	return m.client.IsConnected()
+	return m.conn.isConnected()
 }
 
+// the broker does not send the last will on a clean disconnect, so the offline status
+// is published before
 func (m *MqttClient) Disconnect() {
-	m.client.Disconnect(0)
+	if m.presence != nil && m.conn.isConnected() {
+		m.presence.publishOffline(m.conn)
+	}
+	m.conn.disconnect()
+}
+
+// publish a message, messages which can not be delivered within PUBLISH_TIMEOUT are dropped
+func (m *MqttClient) Publish(topic string, payload []byte, qos byte) {
+	m.PublishWithProperties(topic, payload, qos, nil)
 }
 
-func (m *MqttClient) Publish(topic string, payload interface{}, qos byte) {
-	token := m.client.Publish(topic, qos, false, payload)
-	token.Wait()
+func (m *MqttClient) PublishWithProperties(topic string, payload []byte, qos byte, props *PublishProperties) {
+	if err := m.conn.publish(topic, payload, qos, false, props); err != nil {
+		fmt.Printf("publish to %s failed: %v\n", topic, err)
+	}
+}
+
+// publish a message which must not get lost. If the broker is not reachable the message
+// is queued in the outbox and replayed in order on reconnect
+func (m *MqttClient) PublishQueued(topic string, payload []byte, qos byte) {
+	m.PublishQueuedWithProperties(topic, payload, qos, nil)
+}
+
+func (m *MqttClient) PublishQueuedWithProperties(topic string, payload []byte, qos byte, props *PublishProperties) {
+	if m.outbox == nil {
+		m.PublishWithProperties(topic, payload, qos, props)
+		return
+	}
+
+	m.outbox.publish(m.conn, topic, payload, qos, props)
 }
 
-func (m *MqttClient) Subscribe(topic string, callback mqtt.MessageHandler, qos byte) {
-	topicList = append(topicList, Topic{Topic: topic, Cb: callback})
-	if token := m.client.Subscribe(topic, qos, callback); token.Wait() && token.Error() != nil {
-		fmt.Println(token.Error())
+func (m *MqttClient) Subscribe(topic string, callback MessageHandler, qos byte) {
+	m.topicLock.Lock()
+	m.topics = append(m.topics, Topic{Topic: topic, Qos: qos, Cb: callback})
+	m.topicLock.Unlock()
+
+	if !m.conn.isConnected() {
+		//subscribed by onConnect
+		return
+	}
+
+	if err := m.conn.subscribe(topic, qos, callback); err != nil {
+		fmt.Println(err)
 	}
 }
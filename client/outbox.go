@@ -0,0 +1,288 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OUTBOX_OVERFLOW_DROP_OLDEST = "drop-oldest"
+	OUTBOX_OVERFLOW_DROP_NEWEST = "drop-newest"
+)
+
+// time to wait for the broker to acknowledge a message before it is kept in the outbox
+const PUBLISH_TIMEOUT = 10 * time.Second
+
+// interval in which queued messages are retried while connected, e.g. after a timeout
+const OUTBOX_RETRY_INTERVAL = 30 * time.Second
+
+type OutboxStats struct {
+	Queued   int    `json:"queued"`
+	Dropped  uint64 `json:"dropped"`
+	Replayed uint64 `json:"replayed"`
+}
+
+type outboxMessage struct {
+	seq     uint64
+	Topic   string `json:"topic"`
+	Qos     byte   `json:"qos"`
+	Payload []byte `json:"payload"`
+
+	Properties *PublishProperties `json:"properties,omitempty"`
+}
+
+// bounded queue for messages which could not be published while the broker was not
+// reachable. The messages are replayed in order once the connection is back. If dir is
+// set every message is also stored as file so the queue survives a restart of the agent
+type Outbox struct {
+	lock     sync.Mutex
+	dir      string
+	max      int
+	overflow string
+	messages []*outboxMessage
+	nextSeq  uint64
+	sending  bool //a goroutine is publishing the queue
+	dropped  uint64
+	replayed uint64
+}
+
+// create an outbox holding up to max messages. overflow decides which message is
+// dropped if the outbox is full. Messages left in dir from a previous run are loaded
+func NewOutbox(dir string, max int, overflow string) (*Outbox, error) {
+	if max <= 0 {
+		return nil, fmt.Errorf("outbox size must be positive")
+	}
+
+	switch overflow {
+	case "":
+		overflow = OUTBOX_OVERFLOW_DROP_OLDEST
+	case OUTBOX_OVERFLOW_DROP_OLDEST, OUTBOX_OVERFLOW_DROP_NEWEST:
+	default:
+		return nil, fmt.Errorf("unknown outbox overflow policy %s", overflow)
+	}
+
+	o := &Outbox{
+		dir:      dir,
+		max:      max,
+		overflow: overflow,
+		messages: make([]*outboxMessage, 0),
+	}
+
+	if dir == "" {
+		return o, nil
+	}
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(file), ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		msg := &outboxMessage{seq: seq}
+		if err := json.Unmarshal(data, msg); err != nil {
+			//broken message, e.g. the agent died while writing it
+			os.Remove(file)
+			continue
+		}
+
+		o.messages = append(o.messages, msg)
+		o.nextSeq = seq + 1
+	}
+
+	//the size might have been reduced since the last run
+	for len(o.messages) > o.max {
+		o.dropFirst()
+	}
+
+	return o, nil
+}
+
+func (o *Outbox) Stats() OutboxStats {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return OutboxStats{
+		Queued:   len(o.messages),
+		Dropped:  o.dropped,
+		Replayed: o.replayed,
+	}
+}
+
+// publish the message directly if the outbox is empty and the client is connected,
+// otherwise queue it behind the messages which are already waiting and try to send
+// the queue. The lock is not held while publishing, so callers do not wait for
+// each other
+func (o *Outbox) publish(conn connection, topic string, payload []byte, qos byte, props *PublishProperties) {
+	o.lock.Lock()
+
+	//the sequence keeps the order if the message has to be queued later on
+	msg := &outboxMessage{seq: o.nextSeq, Topic: topic, Qos: qos, Payload: payload, Properties: props}
+	o.nextSeq++
+
+	if o.sending || len(o.messages) > 0 || !conn.isConnected() {
+		o.push(msg)
+		o.lock.Unlock()
+		o.drain(conn)
+		return
+	}
+
+	o.sending = true
+	o.lock.Unlock()
+
+	if conn.publish(topic, payload, qos, false, props) != nil {
+		//retried by the next publish or the retry loop, not right away
+		o.lock.Lock()
+		o.pushFront(msg)
+		o.sending = false
+		o.lock.Unlock()
+		return
+	}
+
+	//messages queued while this one was sent
+	o.send(conn)
+}
+
+// replay the queued messages in order until the outbox is empty or publishing fails
+func (o *Outbox) flush(conn connection) {
+	o.drain(conn)
+}
+
+// send the queue unless another goroutine is already sending it
+func (o *Outbox) drain(conn connection) {
+	o.lock.Lock()
+	if o.sending {
+		o.lock.Unlock()
+		return
+	}
+	o.sending = true
+	o.lock.Unlock()
+
+	o.send(conn)
+}
+
+// publish the first message until the queue is empty or publishing fails. The caller
+// has set sending, which is cleared once done
+func (o *Outbox) send(conn connection) {
+	for {
+		o.lock.Lock()
+		if len(o.messages) == 0 || !conn.isConnected() {
+			o.sending = false
+			o.lock.Unlock()
+			return
+		}
+		msg := o.messages[0]
+		o.lock.Unlock()
+
+		err := conn.publish(msg.Topic, msg.Payload, msg.Qos, false, msg.Properties)
+
+		o.lock.Lock()
+		if err != nil {
+			o.sending = false
+			o.lock.Unlock()
+			return
+		}
+
+		//the message may have been dropped by the overflow policy while it was sent
+		if len(o.messages) > 0 && o.messages[0] == msg {
+			o.removeFirst()
+		}
+		o.replayed++
+		o.lock.Unlock()
+	}
+}
+
+func (o *Outbox) push(msg *outboxMessage) {
+	if len(o.messages) >= o.max {
+		if o.overflow == OUTBOX_OVERFLOW_DROP_NEWEST {
+			o.dropped++
+			return
+		}
+		o.dropFirst()
+	}
+
+	o.messages = append(o.messages, msg)
+	o.store(msg)
+}
+
+// queue a message which failed to send directly. It is older than the messages queued
+// while it was sent, so it goes in front of them
+func (o *Outbox) pushFront(msg *outboxMessage) {
+	if len(o.messages) >= o.max {
+		if o.overflow == OUTBOX_OVERFLOW_DROP_OLDEST {
+			o.dropped++
+			return
+		}
+		o.removeLast()
+		o.dropped++
+	}
+
+	o.messages = append([]*outboxMessage{msg}, o.messages...)
+	o.store(msg)
+}
+
+func (o *Outbox) store(msg *outboxMessage) {
+	if o.dir == "" {
+		return
+	}
+
+	data, err := json.Marshal(msg)
+	if err == nil {
+		err = os.WriteFile(o.file(msg), data, 0600)
+	}
+	if err != nil {
+		//the message is still kept in memory
+		fmt.Printf("could not store outbox message: %v\n", err)
+	}
+}
+
+func (o *Outbox) dropFirst() {
+	o.removeFirst()
+	o.dropped++
+}
+
+func (o *Outbox) removeFirst() {
+	msg := o.messages[0]
+	o.messages[0] = nil
+	o.messages = o.messages[1:]
+
+	if o.dir != "" {
+		os.Remove(o.file(msg))
+	}
+}
+
+func (o *Outbox) removeLast() {
+	msg := o.messages[len(o.messages)-1]
+	o.messages[len(o.messages)-1] = nil
+	o.messages = o.messages[:len(o.messages)-1]
+
+	if o.dir != "" {
+		os.Remove(o.file(msg))
+	}
+}
+
+func (o *Outbox) file(msg *outboxMessage) string {
+	return filepath.Join(o.dir, fmt.Sprintf("%020d.json", msg.seq))
+}
@@ -0,0 +1,203 @@
+package client
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeConnection struct {
+	lock      sync.Mutex
+	connected bool
+	fail      bool
+	block     chan struct{} //publish waits for it if set
+	published []string
+}
+
+func (c *fakeConnection) connect() error { return nil }
+func (c *fakeConnection) disconnect()    {}
+
+func (c *fakeConnection) isConnected() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.connected
+}
+
+func (c *fakeConnection) publish(topic string, payload []byte, qos byte, retain bool, props *PublishProperties) error {
+	c.lock.Lock()
+	block := c.block
+	c.lock.Unlock()
+	if block != nil {
+		<-block
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.fail {
+		return errors.New("publish failed")
+	}
+	c.published = append(c.published, string(payload))
+	return nil
+}
+
+func (c *fakeConnection) subscribe(topic string, qos byte, callback MessageHandler) error {
+	return nil
+}
+
+func (c *fakeConnection) set(connected, fail bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.connected = connected
+	c.fail = fail
+}
+
+func (c *fakeConnection) messages() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]string{}, c.published...)
+}
+
+func publishAll(o *Outbox, conn connection, payloads ...string) {
+	for _, p := range payloads {
+		o.publish(conn, "topic", []byte(p), 1, nil)
+	}
+}
+
+func TestOutboxOverflow(t *testing.T) {
+	tests := []struct {
+		overflow string
+		want     []string
+	}{
+		{OUTBOX_OVERFLOW_DROP_OLDEST, []string{"3", "4", "5"}},
+		{OUTBOX_OVERFLOW_DROP_NEWEST, []string{"1", "2", "3"}},
+	}
+
+	for _, tt := range tests {
+		o, err := NewOutbox("", 3, tt.overflow)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conn := &fakeConnection{}
+		publishAll(o, conn, "1", "2", "3", "4", "5")
+
+		if stats := o.Stats(); stats != (OutboxStats{Queued: 3, Dropped: 2}) {
+			t.Errorf("%s: stats %+v", tt.overflow, stats)
+		}
+
+		conn.set(true, false)
+		o.flush(conn)
+
+		if got := conn.messages(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: replayed %v, want %v", tt.overflow, got, tt.want)
+		}
+		if stats := o.Stats(); stats != (OutboxStats{Queued: 0, Dropped: 2, Replayed: 3}) {
+			t.Errorf("%s: stats after flush %+v", tt.overflow, stats)
+		}
+	}
+}
+
+func TestOutboxFailedPublish(t *testing.T) {
+	o, err := NewOutbox("", 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := &fakeConnection{connected: true, fail: true}
+	publishAll(o, conn, "1", "2")
+	if stats := o.Stats(); stats.Queued != 2 {
+		t.Fatalf("failed messages must be queued, stats %+v", stats)
+	}
+
+	//a direct publish is not possible while messages are waiting, order is kept
+	conn.set(true, false)
+	publishAll(o, conn, "3")
+
+	if got, want := conn.messages(), []string{"1", "2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+}
+
+func TestOutboxPersistence(t *testing.T) {
+	dir := t.TempDir()
+
+	o, err := NewOutbox(dir, 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publishAll(o, &fakeConnection{}, "1", "2", "3")
+
+	//restart with a smaller outbox, the oldest message is dropped
+	o, err = NewOutbox(dir, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := o.Stats(); stats != (OutboxStats{Queued: 2, Dropped: 1}) {
+		t.Fatalf("stats after reload %+v", stats)
+	}
+
+	conn := &fakeConnection{connected: true}
+	o.flush(conn)
+	publishAll(o, conn, "4")
+
+	if got, want := conn.messages(), []string{"2", "3", "4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+
+	//everything was sent, nothing is left for the next run
+	o, err = NewOutbox(dir, 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := o.Stats(); stats.Queued != 0 {
+		t.Errorf("sent messages are still stored, stats %+v", stats)
+	}
+}
+
+func TestOutboxPublishDoesNotBlock(t *testing.T) {
+	o, err := NewOutbox("", 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := make(chan struct{})
+	conn := &fakeConnection{connected: true, block: block}
+
+	done := make(chan struct{})
+	go func() {
+		publishAll(o, conn, "1")
+		close(done)
+	}()
+
+	//wait until the first publish is in flight
+	for {
+		o.lock.Lock()
+		sending := o.sending
+		o.lock.Unlock()
+		if sending {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	queued := make(chan struct{})
+	go func() {
+		publishAll(o, conn, "2")
+		close(queued)
+	}()
+
+	select {
+	case <-queued:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked behind the message in flight")
+	}
+
+	close(block)
+	<-done
+
+	if got, want := conn.messages(), []string{"1", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+}
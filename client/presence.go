@@ -0,0 +1,18 @@
+package client
+
+// retained status message of the instance. Online is published on every connect,
+// Offline is registered as last will so the broker publishes it if the connection
+// drops and is also sent on a clean disconnect
+type Presence struct {
+	Topic   string
+	Online  []byte
+	Offline []byte
+}
+
+func (p *Presence) publishOnline(conn connection) {
+	conn.publish(p.Topic, p.Online, 1, true, nil)
+}
+
+func (p *Presence) publishOffline(conn connection) {
+	conn.publish(p.Topic, p.Offline, 1, true, nil)
+}
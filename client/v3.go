@@ -0,0 +1,83 @@
+package client
+
+import (
+	"fmt"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MQTT 3.1 and 3.1.1 connection, properties are not supported and get dropped
+type connectionV3 struct {
+	client mqtt.Client
+}
+
+func newConnectionV3(cfg ClientConfig, onConnect func()) *connectionV3 {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(cfg.Broker)
+	opts.SetClientID(cfg.ClientId)
+	opts.SetUsername(cfg.Username)
+	opts.SetPassword(cfg.Password)
+	if cfg.ProtocolVersion != 0 {
+		opts.SetProtocolVersion(cfg.ProtocolVersion)
+	}
+	if cfg.Tls != nil {
+		opts.SetTLSConfig(cfg.Tls)
+	}
+	if cfg.Presence != nil {
+		opts.SetBinaryWill(cfg.Presence.Topic, cfg.Presence.Offline, 1, true)
+	}
+
+	opts.SetConnectRetry(true)
+	opts.SetAutoReconnect(true)
+	opts.SetResumeSubs(true)
+
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		//the handler must not block the client
+		go onConnect()
+	})
+
+	opts.OnConnectionLost = func(client mqtt.Client, err error) {
+		fmt.Printf("Connection lost: %v", err)
+	}
+	opts.OnReconnecting = func(client mqtt.Client, options *mqtt.ClientOptions) {
+		fmt.Printf("Reconnecting:\n")
+	}
+
+	return &connectionV3{
+		client: mqtt.NewClient(opts),
+	}
+}
+
+func (c *connectionV3) connect() error {
+	if token := c.client.Connect(); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+func (c *connectionV3) disconnect() {
+	c.client.Disconnect(250)
+}
+
+func (c *connectionV3) isConnected() bool {
+	return c.client.IsConnectionOpen()
+}
+
+func (c *connectionV3) publish(topic string, payload []byte, qos byte, retain bool, props *PublishProperties) error {
+	token := c.client.Publish(topic, qos, retain, payload)
+	if !token.WaitTimeout(PUBLISH_TIMEOUT) {
+		return fmt.Errorf("publish timed out")
+	}
+	return token.Error()
+}
+
+func (c *connectionV3) subscribe(topic string, qos byte, callback MessageHandler) error {
+	token := c.client.Subscribe(topic, qos, func(client mqtt.Client, msg mqtt.Message) {
+		callback(&Message{
+			Topic:   msg.Topic(),
+			Payload: msg.Payload(),
+		})
+	})
+	token.Wait()
+	return token.Error()
+}
@@ -0,0 +1,232 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// MQTT v5 connection
+type connectionV5 struct {
+	cfg       autopaho.ClientConfig
+	cm        atomic.Pointer[autopaho.ConnectionManager]
+	connected atomic.Bool
+
+	handlerLock sync.RWMutex
+	handlers    map[string]MessageHandler //by topic filter
+}
+
+func newConnectionV5(cfg ClientConfig, onConnect func()) (*connectionV5, error) {
+	brokerUrl, err := url.Parse(cfg.Broker)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &connectionV5{
+		handlers: make(map[string]MessageHandler),
+	}
+
+	c.cfg = autopaho.ClientConfig{
+		ServerUrls:      []*url.URL{brokerUrl},
+		TlsCfg:          cfg.Tls,
+		KeepAlive:       30,
+		ConnectUsername: cfg.Username,
+		ConnectPassword: []byte(cfg.Password),
+		OnConnectionUp: func(cm *autopaho.ConnectionManager, connAck *paho.Connack) {
+			//might be called before NewConnection returns
+			c.cm.Store(cm)
+			c.connected.Store(true)
+			onConnect()
+		},
+		OnConnectError: func(err error) {
+			fmt.Printf("Connection error: %v\n", err)
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID: cfg.ClientId,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				func(pr paho.PublishReceived) (bool, error) {
+					c.route(pr.Packet)
+					return true, nil
+				},
+			},
+			OnClientError: func(err error) {
+				c.connected.Store(false)
+				fmt.Printf("Connection lost: %v\n", err)
+			},
+			OnServerDisconnect: func(d *paho.Disconnect) {
+				c.connected.Store(false)
+				fmt.Printf("Disconnected by server: %d\n", d.ReasonCode)
+			},
+		},
+	}
+
+	if cfg.Presence != nil {
+		c.cfg.WillMessage = &paho.WillMessage{
+			Topic:   cfg.Presence.Topic,
+			Payload: cfg.Presence.Offline,
+			QoS:     1,
+			Retain:  true,
+		}
+	}
+
+	return c, nil
+}
+
+// connect and wait until the broker is reachable, reconnects are handled by autopaho
+func (c *connectionV5) connect() error {
+	ctx := context.Background()
+
+	cm, err := autopaho.NewConnection(ctx, c.cfg)
+	if err != nil {
+		return err
+	}
+	c.cm.Store(cm)
+
+	return cm.AwaitConnection(ctx)
+}
+
+func (c *connectionV5) disconnect() {
+	cm := c.cm.Load()
+	if cm == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), PUBLISH_TIMEOUT)
+	defer cancel()
+
+	cm.Disconnect(ctx)
+	c.connected.Store(false)
+}
+
+func (c *connectionV5) isConnected() bool {
+	return c.cm.Load() != nil && c.connected.Load()
+}
+
+func (c *connectionV5) publish(topic string, payload []byte, qos byte, retain bool, props *PublishProperties) error {
+	cm := c.cm.Load()
+	if cm == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), PUBLISH_TIMEOUT)
+	defer cancel()
+
+	_, err := cm.Publish(ctx, &paho.Publish{
+		Topic:      topic,
+		QoS:        qos,
+		Retain:     retain,
+		Payload:    payload,
+		Properties: publishProperties(props),
+	})
+
+	return err
+}
+
+func (c *connectionV5) subscribe(topic string, qos byte, callback MessageHandler) error {
+	c.handlerLock.Lock()
+	c.handlers[topic] = callback
+	c.handlerLock.Unlock()
+
+	cm := c.cm.Load()
+	if cm == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), PUBLISH_TIMEOUT)
+	defer cancel()
+
+	_, err := cm.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: qos}},
+	})
+
+	return err
+}
+
+// call the handlers of all subscriptions matching the topic of the message
+func (c *connectionV5) route(p *paho.Publish) {
+	msg := &Message{
+		Topic:   p.Topic,
+		Payload: p.Payload,
+	}
+
+	if p.Properties != nil {
+		msg.ResponseTopic = p.Properties.ResponseTopic
+		msg.CorrelationData = p.Properties.CorrelationData
+		if len(p.Properties.User) > 0 {
+			msg.UserProperties = make(map[string]string, len(p.Properties.User))
+			for _, prop := range p.Properties.User {
+				msg.UserProperties[prop.Key] = prop.Value
+			}
+		}
+	}
+
+	c.handlerLock.RLock()
+	defer c.handlerLock.RUnlock()
+
+	for filter, handler := range c.handlers {
+		if topicMatches(filter, p.Topic) {
+			handler(msg)
+		}
+	}
+}
+
+func publishProperties(props *PublishProperties) *paho.PublishProperties {
+	if props == nil {
+		return nil
+	}
+
+	p := &paho.PublishProperties{
+		CorrelationData: props.CorrelationData,
+	}
+
+	if props.MessageExpiry > 0 {
+		expiry := props.MessageExpiry
+		p.MessageExpiry = &expiry
+	}
+
+	for key, value := range props.UserProperties {
+		p.User.Add(key, value)
+	}
+
+	return p
+}
+
+// checks if the topic matches the subscription filter including + and # wildcards
+// and shared subscriptions ($share/<group>/<filter>)
+func topicMatches(filter, topic string) bool {
+	if strings.HasPrefix(filter, "$share/") {
+		parts := strings.SplitN(filter, "/", 3)
+		if len(parts) < 3 {
+			return false
+		}
+		filter = parts[2]
+	}
+
+	filterParts := strings.Split(filter, "/")
+	topicParts := strings.Split(topic, "/")
+
+	//wildcards at the first level do not match system topics like $SYS/...
+	if strings.HasPrefix(topic, "$") && (filterParts[0] == "+" || filterParts[0] == "#") {
+		return false
+	}
+
+	for i, part := range filterParts {
+		if part == "#" {
+			return true
+		}
+		if i >= len(topicParts) {
+			return false
+		}
+		if part != "+" && part != topicParts[i] {
+			return false
+		}
+	}
+
+	return len(filterParts) == len(topicParts)
+}
@@ -0,0 +1,38 @@
+package client
+
+import "testing"
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"app/instance", "app/instance", true},
+		{"app/instance", "app/other", false},
+		{"app/instance", "app/instance/sub", false},
+		{"app/+", "app/instance", true},
+		{"app/+", "app/", true},
+		{"app/+", "app", false},
+		{"app/+", "app/instance/sub", false},
+		{"app/+/event", "app/instance/event", true},
+		{"+/+", "/finance", true},
+		{"+", "/finance", false},
+		{"app/#", "app", true},
+		{"app/#", "app/instance/event", true},
+		{"app/#", "other/instance", false},
+		{"#", "app/instance", true},
+		{"#", "$SYS/broker/uptime", false},
+		{"+/broker/uptime", "$SYS/broker/uptime", false},
+		{"$SYS/#", "$SYS/broker/uptime", true},
+		{"$share/agents/app/+", "app/instance", true},
+		{"$share/agents/app/+", "other/instance", false},
+		{"$share/agents", "agents", false},
+	}
+
+	for _, tt := range tests {
+		if got := topicMatches(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("topicMatches(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
@@ -2,10 +2,19 @@ package docker
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"path"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/distribution/reference"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/events"
@@ -14,6 +23,7 @@ import (
 	"github.com/docker/docker/api/types/network"
 	sdkClient "github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-units"
 )
 
 type Docker struct {
@@ -22,14 +32,165 @@ type Docker struct {
 	networkId      string
 	networkSubnet  string
 	networkGateway string
+	registries     []RegistryAuth
+	appName        string
+	instanceId     string
+	events         map[string][]string
 }
 
 type ContainerEventData struct {
+	Type     string //container, image or network
 	ID       string
 	Name     string
 	Image    string
 	Status   string
+	Health   string //healthy or unhealthy for health_status events
 	ExitCode string
+	Signal   string
+	Network  string //network name of network events
+	Labels   map[string]string
+	Error    string //reason of daemon disconnected events
+}
+
+// events generated by the agent if the connection to the docker daemon is lost
+const (
+	EVENT_TYPE_DAEMON   = "daemon"
+	DAEMON_DISCONNECTED = "disconnected"
+	DAEMON_RECONNECTED  = "reconnected"
+)
+
+// docker events forwarded by default, keyed by event type
+var DefaultEvents = map[string][]string{
+	"container": {"create", "start", "die", "stop", "kill", "oom", "restart", "destroy", "pause", "unpause", "health_status"},
+	"image":     {"pull", "delete"},
+	"network":   {"connect", "disconnect"},
+}
+
+// actions reported by the docker daemon for the supported event types
+var KnownEvents = map[string][]string{
+	"container": {"attach", "commit", "copy", "create", "destroy", "detach", "die", "exec_create", "exec_detach", "exec_die", "exec_start", "export", "health_status", "kill", "oom", "pause", "rename", "resize", "restart", "start", "stop", "top", "unpause", "update"},
+	"image":     {"delete", "import", "load", "pull", "push", "save", "tag", "untag"},
+	"network":   {"create", "connect", "destroy", "disconnect", "remove"},
+}
+
+// the event stream is reconnected with backoff, it is reset once a stream was
+// healthy for EVENTS_STABLE_DURATION
+const (
+	EVENTS_MIN_BACKOFF     = time.Second
+	EVENTS_MAX_BACKOFF     = 30 * time.Second
+	EVENTS_STABLE_DURATION = time.Minute
+)
+
+const (
+	PULL_POLICY_ALWAYS         = "always"
+	PULL_POLICY_IF_NOT_PRESENT = "if-not-present"
+	PULL_POLICY_NEVER          = "never"
+)
+
+// labels set on the containers created by the agent
+const (
+	LABEL_MANAGED     = "mqtt-docker-sdk.managed"
+	LABEL_APP_NAME    = "mqtt-docker-sdk.app-name"
+	LABEL_INSTANCE_ID = "mqtt-docker-sdk.instance-id"
+	LABEL_REQUEST_ID  = "mqtt-docker-sdk.request-id"
+	LABEL_SPEC_HASH   = "mqtt-docker-sdk.spec-hash"
+	LABEL_CREATED     = "mqtt-docker-sdk.created"
+
+	// set by the reconciler, only containers with this label are recreated or
+	// removed when the desired state changes
+	LABEL_DESIRED_STATE = "mqtt-docker-sdk.desired-state"
+)
+
+// returned (wrapped) if an image is not available locally and may not be pulled or
+// does not exist in the registry
+var ErrImageNotFound = errors.New("image not found")
+
+// returned (wrapped) by EnsureImage if pulling the image failed
+var ErrImagePull = errors.New("could not pull image")
+
+// configuration of a container created by ContainerCreateAndStart
+type ContainerSpec struct {
+	ImageName     string
+	ContainerName string
+	User          string
+	Restart       string
+	Ip            string //ip address on the agents network, empty for a dynamic address
+	PullPolicy    string
+	Ports         []string //containerPort:hostPort[:hostIp]
+	Volumes       []string //hostPath:containerPath[:ro|rw], always bind mounts
+	NamedVolumes  []string //volumeName:containerPath[:ro|rw], docker volumes (e.g. declared by a stack)
+	Environment   []string
+	Commands      []string
+	Labels        map[string]string
+	Auth          *RegistryAuth //overrides the configured registry credentials (can be nil)
+	Network       string        //network the container is attached to, default is the agents network
+	Aliases       []string      //additional dns names of the container on its network
+
+	//resource limits, zero values mean unlimited
+	Memory     int64 //bytes
+	MemorySwap int64 //memory + swap in bytes, -1 for unlimited swap
+	CpuShares  int64
+	CpuPeriod  int64
+	CpuQuota   int64
+	NanoCpus   int64 //cpu quota in units of 10^-9 cpus
+	CpusetCpus string
+	PidsLimit  *int64
+	Ulimits    []Ulimit
+	ShmSize    int64 //bytes
+
+	//security options
+	ReadOnlyRootfs  bool
+	CapAdd          []string
+	CapDrop         []string
+	NoNewPrivileges bool
+	Tmpfs           map[string]string //container path -> mount options
+
+	Healthcheck *Healthcheck //nil uses the healthcheck of the image
+}
+
+// healthcheck of a container, zero values inherit the settings of the image
+type Healthcheck struct {
+	Test        []string //{"CMD", args...}, {"CMD-SHELL", command} or {"NONE"}
+	Interval    time.Duration
+	Timeout     time.Duration
+	StartPeriod time.Duration
+	Retries     int
+}
+
+type Ulimit struct {
+	Name string
+	Soft int64
+	Hard int64
+}
+
+// hash of the container configuration which is stored in the LABEL_SPEC_HASH label.
+// Labels and registry credentials are not part of the hash
+func (s *ContainerSpec) Hash() string {
+	tmp := *s
+	tmp.Labels = nil
+	tmp.Auth = nil
+
+	data, _ := json.Marshal(tmp)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+type ContainerFilter struct {
+	Labels []string //label or label=value
+	Name   string
+	Image  string
+	State  string //created, restarting, running, removing, paused, exited or dead
+}
+
+type ContainerInfo struct {
+	ID      string
+	Names   []string
+	Image   string
+	State   string
+	Status  string
+	Ports   []string
+	Labels  map[string]string
+	Created time.Time
 }
 
 func (d *Docker) Init(networkId, networkSubnet string, networkGateway string) error {
@@ -45,6 +206,33 @@ func (d *Docker) Init(networkId, networkSubnet string, networkGateway string) er
 	return nil
 }
 
+// set the app name and instance id the containers created by the agent are labeled with
+func (d *Docker) SetInstance(appName, instanceId string) {
+	d.appName = appName
+	d.instanceId = instanceId
+}
+
+// set the docker events which are forwarded by ContainerEvents, keyed by event type
+// (container, image, network). nil forwards the DefaultEvents. Types and actions which
+// are not in KnownEvents are rejected, they would silently never match
+func (d *Docker) SetEvents(events map[string][]string) error {
+	for eventType, actions := range events {
+		known, ok := KnownEvents[eventType]
+		if !ok {
+			return fmt.Errorf("unknown event type %s", eventType)
+		}
+
+		for _, action := range actions {
+			if !slices.Contains(known, action) {
+				return fmt.Errorf("unknown %s event %s", eventType, action)
+			}
+		}
+	}
+
+	d.events = events
+	return nil
+}
+
 func (d *Docker) Enabled() bool {
 	return d.enabled
 }
@@ -84,21 +272,58 @@ func (d *Docker) NetworkCreate(id, subnet string) (string, string, error) {
 	return netData.ID, "", nil
 }
 
-func (d *Docker) PullImage(imageName string) {
-	ctx := context.Background()
-	d.dockerClient.ImagePull(ctx, imageName, types.ImagePullOptions{})
+// pull an image and wait until the pull is finished. auth overrides the configured
+// registry credentials (can be nil)
+func (d *Docker) PullImage(imageName string, auth *RegistryAuth) error {
+	_, err := d.PullImageWithProgress(context.Background(), imageName, auth, nil)
+	return err
 }
 
-// function that checks if an image exists
+// function that checks if an image exists. imageName must match a local image exactly,
+// either by reference (a missing tag defaults to latest), by digest (name@sha256:...)
+// or by image id. Like the docker cli the id may be shortened to 12 characters
 func (d *Docker) ImageExists(imageName string) bool {
 	ctx := context.Background()
 	images, _ := d.dockerClient.ImageList(ctx, types.ImageListOptions{})
 
+	for _, image := range images {
+		if imageIdMatches(image.ID, imageName) {
+			return true
+		}
+	}
+
+	ref, err := reference.ParseNormalizedNamed(imageName)
+	if err != nil {
+		return false
+	}
+
+	if canonical, ok := ref.(reference.Canonical); ok {
+		for _, image := range images {
+			for _, repoDigest := range image.RepoDigests {
+				other, err := reference.ParseNormalizedNamed(repoDigest)
+				if err != nil {
+					continue
+				}
+
+				otherCanonical, ok := other.(reference.Canonical)
+				if ok && otherCanonical.Name() == canonical.Name() && otherCanonical.Digest() == canonical.Digest() {
+					return true
+				}
+			}
+		}
+
+		return false
+	}
+
+	name := reference.TagNameOnly(ref).String()
 	for _, image := range images {
 		for _, tag := range image.RepoTags {
+			other, err := reference.ParseNormalizedNamed(tag)
+			if err != nil {
+				continue
+			}
 
-			//check if tag starts with :imageName
-			if strings.HasPrefix(tag, imageName) {
+			if other.String() == name {
 				return true
 			}
 		}
@@ -107,48 +332,214 @@ func (d *Docker) ImageExists(imageName string) bool {
 	return false
 }
 
-// checks if a container is running
-// return bool --> true: container is running, false container is stopped
-// return *string -->  "": container not found, id of the cointainer if it was found
-func (d *Docker) ContainerRunning(containerName string) (bool, string) {
+// make sure the image is available according to the pull policy. Returns ErrImageNotFound
+// if the policy does not allow to pull a missing image and ErrImagePull if the pull failed
+func (d *Docker) EnsureImage(imageName, pullPolicy string, auth *RegistryAuth) error {
+	switch pullPolicy {
+	case PULL_POLICY_ALWAYS:
+		return d.pullImageForStart(imageName, auth)
+
+	case PULL_POLICY_IF_NOT_PRESENT:
+		if d.ImageExists(imageName) {
+			return nil
+		}
+		return d.pullImageForStart(imageName, auth)
+
+	case PULL_POLICY_NEVER:
+		if d.ImageExists(imageName) {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrImageNotFound, imageName)
+	}
+
+	return fmt.Errorf("unknown pull policy %s", pullPolicy)
+}
+
+func (d *Docker) pullImageForStart(imageName string, auth *RegistryAuth) error {
+	err := d.PullImage(imageName, auth)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrImagePull, err)
+	}
+
+	return nil
+}
+
+// minimum length of a shortened image id, the length shown by docker images
+const IMAGE_SHORT_ID_LENGTH = 12
+
+var hexId = regexp.MustCompile(`^[0-9a-f]+$`)
+
+// checks if name is the full id (with or without sha256:) or a hex prefix of at least
+// IMAGE_SHORT_ID_LENGTH characters of the image id
+func imageIdMatches(id, name string) bool {
+	if id == name || id == "sha256:"+name {
+		return true
+	}
+
+	short := strings.TrimPrefix(name, "sha256:")
+	if len(short) < IMAGE_SHORT_ID_LENGTH || !hexId.MatchString(short) {
+		return false
+	}
+
+	return strings.HasPrefix(strings.TrimPrefix(id, "sha256:"), short)
+}
+
+// find a container by its name, returns nil if the container does not exist
+func (d *Docker) ContainerFind(containerName string) (*ContainerInfo, error) {
+	//the name filter matches substrings, so the result has to be checked
+	containers, err := d.ContainerList(ContainerFilter{Name: containerName})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range containers {
+		if len(c.Names) > 0 && c.Names[0] == containerName {
+			return &c, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// true if a container in this state has a process which has to be stopped
+func ContainerActive(state string) bool {
+	return state == "running" || state == "paused" || state == "restarting"
+}
+
+// list all containers (running and stopped) matching the filter. Empty filter
+// fields are ignored
+func (d *Docker) ContainerList(filter ContainerFilter) ([]ContainerInfo, error) {
 	ctx := context.Background()
-	containerList, _ := d.dockerClient.ContainerList(ctx, types.ContainerListOptions{All: false})
-	for _, container := range containerList {
 
-		if container.Names[0] == fmt.Sprintf("/%s", containerName) {
-			return true, container.ID
+	args := filters.NewArgs()
+	for _, label := range filter.Labels {
+		args.Add("label", label)
+	}
+	if filter.Name != "" {
+		args.Add("name", filter.Name)
+	}
+	if filter.Image != "" {
+		args.Add("ancestor", filter.Image)
+	}
+	if filter.State != "" {
+		args.Add("status", filter.State)
+	}
+
+	containerList, err := d.dockerClient.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: args,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]ContainerInfo, 0, len(containerList))
+	for _, c := range containerList {
+		names := make([]string, 0, len(c.Names))
+		for _, name := range c.Names {
+			names = append(names, strings.TrimPrefix(name, "/"))
+		}
+
+		ports := make([]string, 0, len(c.Ports))
+		for _, p := range c.Ports {
+			if p.PublicPort != 0 {
+				ports = append(ports, fmt.Sprintf("%s:%d->%d/%s", p.IP, p.PublicPort, p.PrivatePort, p.Type))
+			} else {
+				ports = append(ports, fmt.Sprintf("%d/%s", p.PrivatePort, p.Type))
+			}
 		}
+
+		result = append(result, ContainerInfo{
+			ID:      c.ID,
+			Names:   names,
+			Image:   c.Image,
+			State:   c.State,
+			Status:  c.Status,
+			Ports:   ports,
+			Labels:  c.Labels,
+			Created: time.Unix(c.Created, 0).UTC(),
+		})
+	}
+
+	return result, nil
+}
+
+// checks a volume given as source:target[:ro|rw]. named is true for docker volumes,
+// otherwise the source is a host path which has to be absolute
+func ValidateVolume(volume string, named bool) error {
+	typ := mount.TypeBind
+	if named {
+		typ = mount.TypeVolume
+	}
+
+	_, err := parseMount(volume, typ)
+	return err
+}
+
+func parseMount(volume string, typ mount.Type) (mount.Mount, error) {
+	tmp := strings.Split(volume, ":")
+	if len(tmp) < 2 || len(tmp) > 3 || tmp[0] == "" || tmp[1] == "" {
+		return mount.Mount{}, fmt.Errorf("invalid volume %s, expected source:target[:ro|rw]", volume)
+	}
+
+	//the daemon rejects relative bind sources
+	if typ == mount.TypeBind && !path.IsAbs(tmp[0]) {
+		return mount.Mount{}, fmt.Errorf("invalid volume %s, the host path must be absolute", volume)
 	}
 
-	//Check if its under the running servers --> there must be an easier way than this
-	containerList, _ = d.dockerClient.ContainerList(ctx, types.ContainerListOptions{All: true})
-	for _, container := range containerList {
+	m := mount.Mount{
+		Type:   typ,
+		Source: tmp[0],
+		Target: tmp[1],
+	}
 
-		if container.Names[0] == fmt.Sprintf("/%s", containerName) {
-			return false, container.ID
+	if len(tmp) == 3 {
+		switch tmp[2] {
+		case "ro":
+			m.ReadOnly = true
+		case "rw":
+		default:
+			return mount.Mount{}, fmt.Errorf("invalid volume %s, unsupported mode %s", volume, tmp[2])
 		}
 	}
 
-	return false, ""
+	return m, nil
 }
 
 // create a docker container and directly start it
-func (d *Docker) ContainerCreateAndStart(imageName, user, containerName, restart, ip string, ports, volumes, environment, commands []string) (string, []string, error) {
+// the image is pulled according to spec.PullPolicy
+func (d *Docker) ContainerCreateAndStart(spec *ContainerSpec) (string, []string, error) {
 	ctx := context.Background()
 
-	d.PullImage(imageName)
+	err := d.EnsureImage(spec.ImageName, spec.PullPolicy, spec.Auth)
+	if err != nil {
+		return "", nil, err
+	}
+
+	labels := map[string]string{}
+	for k, v := range spec.Labels {
+		labels[k] = v
+	}
+	labels[LABEL_MANAGED] = "true"
+	labels[LABEL_APP_NAME] = d.appName
+	labels[LABEL_INSTANCE_ID] = d.instanceId
+	labels[LABEL_SPEC_HASH] = spec.Hash()
+	labels[LABEL_CREATED] = time.Now().UTC().Format(time.RFC3339)
 
 	//prepare ports
 	exposedPorts := make(nat.PortSet)
 	portBinding := nat.PortMap{}
-	for _, port := range ports {
-		tmp := strings.Split(port, ":")
-		portBinding[nat.Port(tmp[0])] = []nat.PortBinding{
-			{
-				// HostIP:   "0.0.0.0",
-				HostPort: tmp[1],
-			},
+	for _, port := range spec.Ports {
+		//the host ip is last so it may be an IPv6 address
+		tmp := strings.SplitN(port, ":", 3)
+		binding := nat.PortBinding{}
+		if len(tmp) > 1 {
+			binding.HostPort = tmp[1]
 		}
+		if len(tmp) > 2 {
+			binding.HostIP = tmp[2]
+		}
+		portBinding[nat.Port(tmp[0])] = []nat.PortBinding{binding}
 		port := nat.Port(tmp[0])
 		exposedPorts[port] = struct{}{}
 	}
@@ -156,55 +547,106 @@ func (d *Docker) ContainerCreateAndStart(imageName, user, containerName, restart
 	//prepare mounts
 	mounts := []mount.Mount{}
 
-	for _, volume := range volumes {
-		tmp := strings.Split(volume, ":")
-		m := mount.Mount{
-			Type:   mount.TypeBind,
-			Source: tmp[0],
-			Target: tmp[1],
+	for _, volume := range spec.Volumes {
+		m, err := parseMount(volume, mount.TypeBind)
+		if err != nil {
+			return "", nil, err
+		}
+		mounts = append(mounts, m)
+	}
+
+	for _, volume := range spec.NamedVolumes {
+		m, err := parseMount(volume, mount.TypeVolume)
+		if err != nil {
+			return "", nil, err
 		}
 		mounts = append(mounts, m)
 	}
 
+	networkId := d.networkId
+	if spec.Network != "" {
+		networkId = spec.Network
+	}
+
+	var healthConfig *container.HealthConfig
+	if spec.Healthcheck != nil {
+		healthConfig = &container.HealthConfig{
+			Test:        spec.Healthcheck.Test,
+			Interval:    spec.Healthcheck.Interval,
+			Timeout:     spec.Healthcheck.Timeout,
+			StartPeriod: spec.Healthcheck.StartPeriod,
+			Retries:     spec.Healthcheck.Retries,
+		}
+	}
+
 	config := container.Config{
 		Tty:             false,
 		AttachStdin:     true,
 		AttachStdout:    true,
-		Env:             environment,
+		Env:             spec.Environment,
 		WorkingDir:      "/app", //every docker container that needs sources must put it under /app
-		Image:           imageName,
-		User:            user,
+		Image:           spec.ImageName,
+		User:            spec.User,
 		ExposedPorts:    exposedPorts,
 		NetworkDisabled: false,
-		Cmd:             commands,
-		Hostname:        containerName,
+		Cmd:             spec.Commands,
+		Hostname:        spec.ContainerName,
+		Labels:          labels,
+		Healthcheck:     healthConfig,
+	}
+
+	ulimits := make([]*units.Ulimit, 0, len(spec.Ulimits))
+	for _, u := range spec.Ulimits {
+		ulimits = append(ulimits, &units.Ulimit{Name: u.Name, Soft: u.Soft, Hard: u.Hard})
+	}
+
+	securityOpt := []string{}
+	if spec.NoNewPrivileges {
+		securityOpt = append(securityOpt, "no-new-privileges:true")
 	}
 
 	hostConfig := container.HostConfig{
-		Mounts:       mounts,
-		AutoRemove:   false,
-		PortBindings: portBinding,
+		Resources: container.Resources{
+			Memory:     spec.Memory,
+			MemorySwap: spec.MemorySwap,
+			CPUShares:  spec.CpuShares,
+			CPUPeriod:  spec.CpuPeriod,
+			CPUQuota:   spec.CpuQuota,
+			NanoCPUs:   spec.NanoCpus,
+			CpusetCpus: spec.CpusetCpus,
+			PidsLimit:  spec.PidsLimit,
+			Ulimits:    ulimits,
+		},
+		ShmSize:        spec.ShmSize,
+		ReadonlyRootfs: spec.ReadOnlyRootfs,
+		CapAdd:         spec.CapAdd,
+		CapDrop:        spec.CapDrop,
+		SecurityOpt:    securityOpt,
+		Tmpfs:          spec.Tmpfs,
+		Mounts:         mounts,
+		AutoRemove:     false,
+		PortBindings:   portBinding,
 		RestartPolicy: container.RestartPolicy{
-			Name: restart,
+			Name: spec.Restart,
 		},
 		// LogConfig:   logConfig,
-		NetworkMode: container.NetworkMode(d.networkId),
+		NetworkMode: container.NetworkMode(networkId),
 	}
 
 	endPoint := network.EndpointSettings{
-		Aliases:   []string{containerName},
-		NetworkID: d.networkId,
+		Aliases:   append([]string{spec.ContainerName}, spec.Aliases...),
+		NetworkID: networkId,
 		IPAMConfig: &network.EndpointIPAMConfig{
-			IPv4Address: ip,
+			IPv4Address: spec.Ip,
 		},
 	}
 
 	endpointsConfig := make(map[string]*network.EndpointSettings)
-	endpointsConfig[d.networkId] = &endPoint
+	endpointsConfig[networkId] = &endPoint
 
 	dockCont, err := d.dockerClient.ContainerCreate(ctx, &config, &hostConfig, &network.NetworkingConfig{
 		EndpointsConfig: endpointsConfig,
-	}, nil, containerName)
+	}, nil, spec.ContainerName)
 	if err != nil {
 		return "", nil, err
 	}
@@ -217,51 +659,259 @@ func (d *Docker) ContainerCreateAndStart(imageName, user, containerName, restart
 	return dockCont.ID, dockCont.Warnings, err
 }
 
-func (d *Docker) ContainerEvents(eve chan<- ContainerEventData) ContainerEventData {
+// stop a container. timeout is the number of seconds docker waits for the container
+// to exit before it gets killed (nil uses the docker default of 10 seconds). signal
+// overrides the stop signal of the container, empty uses the default (SIGTERM)
+func (d *Docker) ContainerStop(containerId string, timeout *int, signal string) error {
 	ctx := context.Background()
+	return d.dockerClient.ContainerStop(ctx, containerId, container.StopOptions{
+		Signal:  signal,
+		Timeout: timeout,
+	})
+}
 
-	// Create a filter for container create, die, and start events
-	filter := filters.NewArgs()
-	filter.Add("type", "container")
-	filter.Add("event", "create")
-	filter.Add("event", "die")
-	filter.Add("event", "start")
+// remove a container. force kills a running container before it gets removed and
+// removeVolumes also removes the anonymous volumes attached to it
+func (d *Docker) ContainerRemove(containerId string, force, removeVolumes bool) error {
+	ctx := context.Background()
+	return d.dockerClient.ContainerRemove(ctx, containerId, types.ContainerRemoveOptions{
+		Force:         force,
+		RemoveVolumes: removeVolumes,
+	})
+}
+
+// restart a container, timeout and signal are used to stop the container
+// (see ContainerStop)
+func (d *Docker) ContainerRestart(containerId string, timeout *int, signal string) error {
+	ctx := context.Background()
+	return d.dockerClient.ContainerRestart(ctx, containerId, container.StopOptions{
+		Signal:  signal,
+		Timeout: timeout,
+	})
+}
+
+// start an existing container
+func (d *Docker) ContainerStart(containerId string) error {
+	ctx := context.Background()
+	return d.dockerClient.ContainerStart(ctx, containerId, types.ContainerStartOptions{})
+}
+
+func (d *Docker) ContainerPause(containerId string) error {
+	ctx := context.Background()
+	return d.dockerClient.ContainerPause(ctx, containerId)
+}
+
+func (d *Docker) ContainerUnpause(containerId string) error {
+	ctx := context.Background()
+	return d.dockerClient.ContainerUnpause(ctx, containerId)
+}
 
-	// Start listening to Docker events
-	eventChan, errChan := d.dockerClient.Events(ctx, types.EventsOptions{Filters: filter})
+// send a signal to the container, empty signal sends SIGKILL
+func (d *Docker) ContainerKill(containerId string, signal string) error {
+	ctx := context.Background()
+	return d.dockerClient.ContainerKill(ctx, containerId, signal)
+}
 
-	fmt.Println("Listening for container events...")
+// wait until the container reports healthy. Returns the health status of the container,
+// "" if the container has no healthcheck. An error is returned if the container becomes
+// unhealthy, stops or the context expires
+func (d *Docker) ContainerWaitHealthy(ctx context.Context, containerId string) (string, error) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
 
 	for {
+		data, err := d.dockerClient.ContainerInspect(ctx, containerId)
+		if err != nil {
+			return "", err
+		}
+
+		if data.State == nil || !data.State.Running {
+			return "", fmt.Errorf("container is not running")
+		}
+
+		if data.State.Health == nil {
+			return "", nil
+		}
+
+		switch data.State.Health.Status {
+		case types.Healthy:
+			return types.Healthy, nil
+		case types.Unhealthy:
+			return types.Unhealthy, fmt.Errorf("container is unhealthy")
+		}
+
 		select {
-		case event := <-eventChan:
-			switch event.Action {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return data.State.Health.Status, fmt.Errorf("container did not become healthy: %w", ctx.Err())
+		}
+	}
+}
+
+// returns the current state of the container (created, running, paused,
+// restarting, removing, exited or dead)
+func (d *Docker) ContainerState(containerId string) (string, error) {
+	ctx := context.Background()
+	data, err := d.dockerClient.ContainerInspect(ctx, containerId)
+	if err != nil {
+		return "", err
+	}
+
+	return data.State.Status, nil
+}
+
+// listen to the docker events enabled with SetEvents (or the default events) and send
+// them to the eve channel. If the connection to the daemon is lost the listener
+// reconnects with backoff and resumes after the last received event, the disconnect
+// and reconnect are sent as daemon events
+func (d *Docker) ContainerEvents(eve chan<- ContainerEventData) ContainerEventData {
+	enabled := d.events
+	if enabled == nil {
+		enabled = DefaultEvents
+	}
+
+	filter := filters.NewArgs()
+	for eventType, actions := range enabled {
+		filter.Add("type", eventType)
+		for _, action := range actions {
+			filter.Add("event", action)
+		}
+	}
+
+	//unix nano of the last event, used to resume after a reconnect. Starts with the time
+	//the listener starts so a reconnect before the first event still resumes
+	lastEvent := time.Now().UnixNano()
+	backoff := EVENTS_MIN_BACKOFF
+
+	for {
+		started := time.Now()
+		ctx, cancel := context.WithCancel(context.Background())
+
+		options := types.EventsOptions{Filters: filter}
+		if lastEvent > 0 {
+			//since is inclusive, skip the last event which was already sent
+			next := lastEvent + 1
+			options.Since = fmt.Sprintf("%d.%09d", next/int64(time.Second), next%int64(time.Second))
+		}
 
-			case "create":
-				// fmt.Printf("Container %s created\n", event.Actor.ID)
-				eve <- handleContainerEvent(event)
+		// Start listening to Docker events
+		eventChan, errChan := d.dockerClient.Events(ctx, options)
+
+		fmt.Println("Listening for container events...")
+
+		err := d.forwardEvents(eventChan, errChan, enabled, eve, &lastEvent)
+		cancel()
+
+		log.Println("Error while listening to events:", err)
+		eve <- ContainerEventData{
+			Type:   EVENT_TYPE_DAEMON,
+			Status: DAEMON_DISCONNECTED,
+			Error:  err.Error(),
+		}
+
+		//a daemon which drops the stream right after accepting it must not cause a
+		//reconnect every second, so the backoff is only reset after a healthy stream
+		if time.Since(started) >= EVENTS_STABLE_DURATION {
+			backoff = EVENTS_MIN_BACKOFF
+		}
+		d.waitForDaemon(&backoff)
 
-			case "die":
-				// fmt.Printf("Container %s died\n", event.Actor.ID)
-				eve <- handleContainerEvent(event)
+		eve <- ContainerEventData{
+			Type:   EVENT_TYPE_DAEMON,
+			Status: DAEMON_RECONNECTED,
+		}
+	}
+}
 
-			case "start":
-				// fmt.Printf("Container %s started\n", event.Actor.ID)
-				eve <- handleContainerEvent(event)
+// forward the events until the event stream fails
+func (d *Docker) forwardEvents(eventChan <-chan events.Message, errChan <-chan error, enabled map[string][]string, eve chan<- ContainerEventData, lastEvent *int64) error {
+	for {
+		select {
+		case event := <-eventChan:
+			*lastEvent = event.TimeNano
+
+			//the filter matches every action for every type, so check the combination
+			action, _, _ := strings.Cut(event.Action, ":")
+			for _, a := range enabled[string(event.Type)] {
+				if a == action {
+					eve <- handleContainerEvent(event)
+					break
+				}
 			}
 		case err := <-errChan:
-			// Handle errors
-			log.Println("Error while listening to events:", err)
+			return err
+		}
+	}
+}
+
+// block until the docker daemon answers again, retrying with exponential backoff. The
+// backoff is doubled after every attempt and kept for the next reconnect
+func (d *Docker) waitForDaemon(backoff *time.Duration) {
+	for {
+		time.Sleep(*backoff)
+
+		*backoff *= 2
+		if *backoff > EVENTS_MAX_BACKOFF {
+			*backoff = EVENTS_MAX_BACKOFF
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := d.dockerClient.Ping(ctx)
+		cancel()
+
+		if err == nil {
+			return
 		}
+
+		log.Println("Docker daemon not reachable:", err)
 	}
 }
 
+// event attributes which are not container labels
+var eventAttributes = map[string]bool{
+	"name":      true,
+	"image":     true,
+	"exitCode":  true,
+	"signal":    true,
+	"execID":    true,
+	"container": true,
+	"type":      true,
+}
+
 func handleContainerEvent(event events.Message) ContainerEventData {
-	return ContainerEventData{
+	status, health, _ := strings.Cut(event.Action, ":")
+
+	data := ContainerEventData{
+		Type:     string(event.Type),
 		ID:       event.Actor.ID,
 		Name:     event.Actor.Attributes["name"],
 		Image:    event.Actor.Attributes["image"],
-		Status:   event.Status,
+		Status:   status,
+		Health:   strings.TrimSpace(health),
 		ExitCode: event.Actor.Attributes["exitCode"],
+		Signal:   event.Actor.Attributes["signal"],
 	}
+
+	switch event.Type {
+	case events.ContainerEventType:
+		data.Labels = make(map[string]string)
+		for k, v := range event.Actor.Attributes {
+			if !eventAttributes[k] {
+				data.Labels[k] = v
+			}
+		}
+
+	case events.ImageEventType:
+		//the actor of image events is the image
+		data.Image = event.Actor.ID
+		data.ID = ""
+
+	case events.NetworkEventType:
+		//the actor of network events is the network, the container is an attribute
+		data.Network = event.Actor.Attributes["name"]
+		data.ID = event.Actor.Attributes["container"]
+		data.Name = ""
+	}
+
+	return data
 }
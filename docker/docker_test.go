@@ -0,0 +1,65 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+func TestParseMount(t *testing.T) {
+	tests := []struct {
+		volume  string
+		typ     mount.Type
+		want    mount.Mount
+		wantErr bool
+	}{
+		{"/srv/data:/data", mount.TypeBind, mount.Mount{Type: mount.TypeBind, Source: "/srv/data", Target: "/data"}, false},
+		{"/srv/data:/data:ro", mount.TypeBind, mount.Mount{Type: mount.TypeBind, Source: "/srv/data", Target: "/data", ReadOnly: true}, false},
+		{"/srv/data:/data:rw", mount.TypeBind, mount.Mount{Type: mount.TypeBind, Source: "/srv/data", Target: "/data"}, false},
+		{"app_data:/data:ro", mount.TypeVolume, mount.Mount{Type: mount.TypeVolume, Source: "app_data", Target: "/data", ReadOnly: true}, false},
+		{"./data:/data", mount.TypeBind, mount.Mount{}, true},
+		{"data:/data", mount.TypeBind, mount.Mount{}, true},
+		{"/srv/data:/data:z", mount.TypeBind, mount.Mount{}, true},
+		{"/srv/data", mount.TypeBind, mount.Mount{}, true},
+		{"/srv/data:", mount.TypeBind, mount.Mount{}, true},
+		{"/a:/b:ro:extra", mount.TypeBind, mount.Mount{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseMount(tt.volume, tt.typ)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.volume, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.volume, got, tt.want)
+		}
+	}
+}
+
+func TestImageIdMatches(t *testing.T) {
+	id := "sha256:4f3e2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f"
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{id, true},
+		{"4f3e2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f", true},
+		{"4f3e2a1b0c9d", true},
+		{"sha256:4f3e2a1b0c9d", true},
+		{"4f3e2a1b0c9d8e7f", true},
+		{"4f3e2a1b0c9", false}, //shorter than 12
+		{"4f3e2a1b0c9e", false},
+		{"4F3E2A1B0C9D", false},
+		{"nginx", false},
+		{"nginx:4f3e2a1b0c9d", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := imageIdMatches(id, tt.name); got != tt.want {
+			t.Errorf("imageIdMatches(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
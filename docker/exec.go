@@ -0,0 +1,66 @@
+package docker
+
+import (
+	"context"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+type ExecOptions struct {
+	Cmd        []string
+	User       string
+	Env        []string
+	WorkingDir string
+}
+
+// run a command inside a running container and copy its output to stdout and stderr.
+// Blocks until the command exits or the context gets canceled and returns the exit
+// code of the command
+func (d *Docker) ContainerExec(ctx context.Context, containerId string, opts ExecOptions, stdout, stderr io.Writer) (int, error) {
+	exec, err := d.dockerClient.ContainerExecCreate(ctx, containerId, types.ExecConfig{
+		User:         opts.User,
+		Env:          opts.Env,
+		WorkingDir:   opts.WorkingDir,
+		Cmd:          opts.Cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	resp, err := d.dockerClient.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Close()
+
+	//the hijacked connection does not know about the context, close it on cancel so
+	//the copy below returns
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			resp.Close()
+		case <-done:
+		}
+	}()
+
+	_, err = stdcopy.StdCopy(stdout, stderr, resp.Reader)
+	if ctx.Err() != nil {
+		return -1, ctx.Err()
+	}
+	if err != nil {
+		return -1, err
+	}
+
+	inspect, err := d.dockerClient.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return -1, err
+	}
+
+	return inspect.ExitCode, nil
+}
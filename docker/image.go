@@ -0,0 +1,181 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// progress of a single layer while pulling an image
+type PullProgress struct {
+	Layer   string
+	Status  string
+	Current int64
+	Total   int64
+}
+
+type ImageInfo struct {
+	ID          string            `json:"imageId"`
+	RepoTags    []string          `json:"repoTags"`
+	RepoDigests []string          `json:"repoDigests"`
+	Size        int64             `json:"size"`
+	Created     time.Time         `json:"created"`
+	Labels      map[string]string `json:"labels"`
+	Containers  int64             `json:"containers"` //number of containers using the image, -1 if unknown
+}
+
+type ImagePruneResult struct {
+	Deleted        []string `json:"deleted"`
+	Untagged       []string `json:"untagged"`
+	SpaceReclaimed uint64   `json:"spaceReclaimed"`
+}
+
+// pull an image and send the progress of every layer to the progress channel (can be nil).
+// auth overrides the configured registry credentials (can be nil). Blocks until the pull
+// is finished and returns the digest of the pulled image
+func (d *Docker) PullImageWithProgress(ctx context.Context, imageName string, auth *RegistryAuth, progress chan<- PullProgress) (string, error) {
+	registryAuth, err := d.encodeRegistryAuth(imageName, auth)
+	if err != nil {
+		return "", err
+	}
+
+	reader, err := d.dockerClient.ImagePull(ctx, imageName, types.ImagePullOptions{
+		RegistryAuth: registryAuth,
+	})
+	if err != nil {
+		return "", wrapPullError(err)
+	}
+	defer reader.Close()
+
+	digest := ""
+	decoder := json.NewDecoder(reader)
+	for {
+		msg := jsonmessage.JSONMessage{}
+		err := decoder.Decode(&msg)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if msg.Error != nil {
+			return "", wrapPullError(errors.New(msg.Error.Message))
+		}
+
+		if strings.HasPrefix(msg.Status, "Digest: ") {
+			digest = strings.TrimPrefix(msg.Status, "Digest: ")
+		}
+
+		if progress != nil {
+			p := PullProgress{
+				Layer:  msg.ID,
+				Status: msg.Status,
+			}
+			if msg.Progress != nil {
+				p.Current = msg.Progress.Current
+				p.Total = msg.Progress.Total
+			}
+
+			select {
+			case progress <- p:
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		}
+	}
+
+	return digest, nil
+}
+
+func (d *Docker) ImageList() ([]ImageInfo, error) {
+	ctx := context.Background()
+	images, err := d.dockerClient.ImageList(ctx, types.ImageListOptions{All: false})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]ImageInfo, 0, len(images))
+	for _, image := range images {
+		result = append(result, ImageInfo{
+			ID:          image.ID,
+			RepoTags:    image.RepoTags,
+			RepoDigests: image.RepoDigests,
+			Size:        image.Size,
+			Created:     time.Unix(image.Created, 0).UTC(),
+			Labels:      image.Labels,
+			Containers:  image.Containers,
+		})
+	}
+
+	return result, nil
+}
+
+// remove an image. force removes the image even if it is used by stopped containers,
+// pruneChildren removes untagged parent images
+func (d *Docker) ImageRemove(imageName string, force, pruneChildren bool) (*ImagePruneResult, error) {
+	ctx := context.Background()
+	items, err := d.dockerClient.ImageRemove(ctx, imageName, types.ImageRemoveOptions{
+		Force:         force,
+		PruneChildren: pruneChildren,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImagePruneResult{Deleted: []string{}, Untagged: []string{}}
+	for _, item := range items {
+		if item.Deleted != "" {
+			result.Deleted = append(result.Deleted, item.Deleted)
+		}
+		if item.Untagged != "" {
+			result.Untagged = append(result.Untagged, item.Untagged)
+		}
+	}
+
+	return result, nil
+}
+
+// remove unused images. all=false only removes dangling images, all=true every image
+// not used by a container. labels limits the prune to images with the labels
+func (d *Docker) ImagePrune(all bool, labels []string) (*ImagePruneResult, error) {
+	ctx := context.Background()
+
+	args := filters.NewArgs()
+	if all {
+		args.Add("dangling", "false")
+	} else {
+		args.Add("dangling", "true")
+	}
+	for _, label := range labels {
+		args.Add("label", label)
+	}
+
+	report, err := d.dockerClient.ImagesPrune(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImagePruneResult{
+		Deleted:        []string{},
+		Untagged:       []string{},
+		SpaceReclaimed: report.SpaceReclaimed,
+	}
+	for _, item := range report.ImagesDeleted {
+		if item.Deleted != "" {
+			result.Deleted = append(result.Deleted, item.Deleted)
+		}
+		if item.Untagged != "" {
+			result.Untagged = append(result.Untagged, item.Untagged)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,23 @@
+package docker
+
+import (
+	"context"
+)
+
+type EngineInfo struct {
+	Version string //version of the docker engine
+	RootDir string //data root of the docker engine, e.g. /var/lib/docker
+}
+
+func (d *Docker) EngineInfo() (*EngineInfo, error) {
+	ctx := context.Background()
+	info, err := d.dockerClient.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EngineInfo{
+		Version: info.ServerVersion,
+		RootDir: info.DockerRootDir,
+	}, nil
+}
@@ -0,0 +1,207 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// normalized description of a container. The config fields use the same format as
+// the parameters of ContainerCreateAndStart so they can be compared directly
+type ContainerDetails struct {
+	ID           string                     `json:"containerId"`
+	Name         string                     `json:"containerName"`
+	Created      string                     `json:"created"`
+	Config       ContainerDetailsConfig     `json:"config"`
+	HostConfig   ContainerDetailsHostConfig `json:"hostConfig"`
+	Mounts       []ContainerDetailsMount    `json:"mounts"`
+	Networks     []ContainerDetailsNetwork  `json:"networks"`
+	IPAddress    string                     `json:"ipAddress"` //ip address on the agents network
+	State        ContainerDetailsState      `json:"state"`
+	RestartCount int                        `json:"restartCount"`
+}
+
+type ContainerDetailsConfig struct {
+	ImageName   string            `json:"imageName"`
+	ImageId     string            `json:"imageId"`
+	User        string            `json:"user"`
+	Hostname    string            `json:"hostname"`
+	WorkingDir  string            `json:"workingDir"`
+	Environment []string          `json:"environment"`
+	Commands    []string          `json:"commands"`
+	Entrypoint  []string          `json:"entrypoint"`
+	Labels      map[string]string `json:"labels"`
+}
+
+type ContainerDetailsHostConfig struct {
+	Restart     string   `json:"restart"`
+	NetworkMode string   `json:"networkMode"`
+	Ports       []string `json:"ports"` //containerPort:hostPort
+	AutoRemove  bool     `json:"autoRemove"`
+	Privileged  bool     `json:"privileged"`
+
+	Memory     int64  `json:"memory"`
+	MemorySwap int64  `json:"memorySwap"`
+	CpuShares  int64  `json:"cpuShares"`
+	CpuPeriod  int64  `json:"cpuPeriod"`
+	CpuQuota   int64  `json:"cpuQuota"`
+	NanoCpus   int64  `json:"nanoCpus"`
+	CpusetCpus string `json:"cpusetCpus"`
+	PidsLimit  *int64 `json:"pidsLimit"`
+	ShmSize    int64  `json:"shmSize"`
+
+	ReadOnly    bool              `json:"readOnly"`
+	CapAdd      []string          `json:"capAdd"`
+	CapDrop     []string          `json:"capDrop"`
+	SecurityOpt []string          `json:"securityOpt"`
+	Tmpfs       map[string]string `json:"tmpfs"`
+}
+
+type ContainerDetailsMount struct {
+	Type        string `json:"type"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	ReadWrite   bool   `json:"readWrite"`
+}
+
+type ContainerDetailsNetwork struct {
+	Name       string   `json:"name"`
+	NetworkId  string   `json:"networkId"`
+	IPAddress  string   `json:"ipAddress"`
+	Gateway    string   `json:"gateway"`
+	MacAddress string   `json:"macAddress"`
+	Aliases    []string `json:"aliases"`
+}
+
+type ContainerDetailsState struct {
+	Status     string `json:"status"`
+	Running    bool   `json:"running"`
+	Paused     bool   `json:"paused"`
+	Restarting bool   `json:"restarting"`
+	OOMKilled  bool   `json:"oomKilled"`
+	ExitCode   int    `json:"exitCode"`
+	Error      string `json:"error,omitempty"`
+	StartedAt  string `json:"startedAt"`
+	FinishedAt string `json:"finishedAt"`
+	Health     string `json:"health,omitempty"` //starting, healthy or unhealthy, empty if no healthcheck is defined
+}
+
+// inspect a container and return its normalized description
+func (d *Docker) ContainerInspect(containerId string) (*ContainerDetails, error) {
+	ctx := context.Background()
+	data, err := d.dockerClient.ContainerInspect(ctx, containerId)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &ContainerDetails{
+		ID:           data.ID,
+		Name:         strings.TrimPrefix(data.Name, "/"),
+		Created:      data.Created,
+		RestartCount: data.RestartCount,
+		Mounts:       []ContainerDetailsMount{},
+		Networks:     []ContainerDetailsNetwork{},
+	}
+
+	if data.Config != nil {
+		details.Config = ContainerDetailsConfig{
+			ImageName:   data.Config.Image,
+			ImageId:     data.Image,
+			User:        data.Config.User,
+			Hostname:    data.Config.Hostname,
+			WorkingDir:  data.Config.WorkingDir,
+			Environment: data.Config.Env,
+			Commands:    data.Config.Cmd,
+			Entrypoint:  data.Config.Entrypoint,
+			Labels:      data.Config.Labels,
+		}
+	}
+
+	if data.HostConfig != nil {
+		ports := []string{}
+		for port, bindings := range data.HostConfig.PortBindings {
+			for _, binding := range bindings {
+				ports = append(ports, fmt.Sprintf("%s:%s", port.Port(), binding.HostPort))
+			}
+		}
+		sort.Strings(ports)
+
+		details.HostConfig = ContainerDetailsHostConfig{
+			Restart:     data.HostConfig.RestartPolicy.Name,
+			NetworkMode: string(data.HostConfig.NetworkMode),
+			Ports:       ports,
+			AutoRemove:  data.HostConfig.AutoRemove,
+			Privileged:  data.HostConfig.Privileged,
+
+			Memory:     data.HostConfig.Memory,
+			MemorySwap: data.HostConfig.MemorySwap,
+			CpuShares:  data.HostConfig.CPUShares,
+			CpuPeriod:  data.HostConfig.CPUPeriod,
+			CpuQuota:   data.HostConfig.CPUQuota,
+			NanoCpus:   data.HostConfig.NanoCPUs,
+			CpusetCpus: data.HostConfig.CpusetCpus,
+			PidsLimit:  data.HostConfig.PidsLimit,
+			ShmSize:    data.HostConfig.ShmSize,
+
+			ReadOnly:    data.HostConfig.ReadonlyRootfs,
+			CapAdd:      data.HostConfig.CapAdd,
+			CapDrop:     data.HostConfig.CapDrop,
+			SecurityOpt: data.HostConfig.SecurityOpt,
+			Tmpfs:       data.HostConfig.Tmpfs,
+		}
+	}
+
+	for _, m := range data.Mounts {
+		details.Mounts = append(details.Mounts, ContainerDetailsMount{
+			Type:        string(m.Type),
+			Source:      m.Source,
+			Destination: m.Destination,
+			ReadWrite:   m.RW,
+		})
+	}
+
+	if data.NetworkSettings != nil {
+		for name, endpoint := range data.NetworkSettings.Networks {
+			if endpoint == nil {
+				continue
+			}
+
+			details.Networks = append(details.Networks, ContainerDetailsNetwork{
+				Name:       name,
+				NetworkId:  endpoint.NetworkID,
+				IPAddress:  endpoint.IPAddress,
+				Gateway:    endpoint.Gateway,
+				MacAddress: endpoint.MacAddress,
+				Aliases:    endpoint.Aliases,
+			})
+
+			if name == d.networkId {
+				details.IPAddress = endpoint.IPAddress
+			}
+		}
+		sort.Slice(details.Networks, func(i, j int) bool {
+			return details.Networks[i].Name < details.Networks[j].Name
+		})
+	}
+
+	if data.State != nil {
+		details.State = ContainerDetailsState{
+			Status:     data.State.Status,
+			Running:    data.State.Running,
+			Paused:     data.State.Paused,
+			Restarting: data.State.Restarting,
+			OOMKilled:  data.State.OOMKilled,
+			ExitCode:   data.State.ExitCode,
+			Error:      data.State.Error,
+			StartedAt:  data.State.StartedAt,
+			FinishedAt: data.State.FinishedAt,
+		}
+
+		if data.State.Health != nil {
+			details.State.Health = data.State.Health.Status
+		}
+	}
+
+	return details, nil
+}
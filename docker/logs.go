@@ -0,0 +1,129 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+const (
+	LOG_STREAM_STDOUT = "stdout"
+	LOG_STREAM_STDERR = "stderr"
+)
+
+type LogOptions struct {
+	Tail   string //number of lines from the end of the logs or "all"
+	Since  string //unix timestamp, RFC3339 date or go duration relative to now (e.g. 10m)
+	Until  string //same format as Since
+	Follow bool
+}
+
+type LogLine struct {
+	Stream    string //stdout or stderr
+	Timestamp time.Time
+	Line      string
+}
+
+// read the logs of a container and send them line by line to the lines channel. The function
+// blocks until all logs are read, in follow mode until the context gets canceled or the
+// container stops
+func (d *Docker) ContainerLogs(ctx context.Context, containerId string, opts LogOptions, lines chan<- LogLine) error {
+	data, err := d.dockerClient.ContainerInspect(ctx, containerId)
+	if err != nil {
+		return err
+	}
+
+	reader, err := d.dockerClient.ContainerLogs(ctx, containerId, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+		Since:      opts.Since,
+		Until:      opts.Until,
+		Follow:     opts.Follow,
+		Tail:       opts.Tail,
+	})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	stdout := &logLineWriter{ctx: ctx, stream: LOG_STREAM_STDOUT, lines: lines}
+	stderr := &logLineWriter{ctx: ctx, stream: LOG_STREAM_STDERR, lines: lines}
+
+	//tty containers do not multiplex stdout and stderr
+	if data.Config != nil && data.Config.Tty {
+		_, err = io.Copy(stdout, reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, reader)
+	}
+
+	stdout.flush()
+	stderr.flush()
+
+	if err != nil && ctx.Err() != nil {
+		//stream was canceled by the caller
+		return nil
+	}
+
+	return err
+}
+
+// splits the docker log stream into lines and parses the timestamp docker puts
+// in front of each line
+type logLineWriter struct {
+	ctx    context.Context
+	stream string
+	lines  chan<- LogLine
+	buf    bytes.Buffer
+}
+
+func (w *logLineWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+
+	for {
+		idx := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if idx < 0 {
+			break
+		}
+
+		line := string(w.buf.Next(idx + 1))
+		if err := w.send(strings.TrimRight(line, "\r\n")); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+func (w *logLineWriter) flush() {
+	if w.buf.Len() > 0 {
+		w.send(w.buf.String())
+		w.buf.Reset()
+	}
+}
+
+func (w *logLineWriter) send(line string) error {
+	logLine := LogLine{
+		Stream: w.stream,
+		Line:   line,
+	}
+
+	if ts, rest, found := strings.Cut(line, " "); found {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			logLine.Timestamp = t
+			logLine.Line = rest
+		}
+	}
+
+	select {
+	case w.lines <- logLine:
+		return nil
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	}
+}
@@ -0,0 +1,110 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+)
+
+// credentials for a private registry. Server is the registry host as it appears in the
+// image reference (e.g. registry.example.com:5000), docker hub is docker.io
+type RegistryAuth struct {
+	Server        string
+	Username      string
+	Password      string
+	IdentityToken string
+}
+
+// returned (wrapped) by the pull functions if the registry rejected the credentials or
+// the image requires credentials which are not configured
+var ErrRegistryAuth = errors.New("registry authentication failed")
+
+// e.g. "manifest for nginx:doesnotexist not found"
+var manifestNotFound = regexp.MustCompile(`manifest .*not found`)
+
+// set the credentials used to pull images from private registries
+func (d *Docker) SetRegistryAuth(registries []RegistryAuth) {
+	d.registries = registries
+}
+
+// returns the encoded credentials for the registry of the image. auth overrides
+// the configured credentials, if no credentials are found an empty string is returned
+func (d *Docker) encodeRegistryAuth(imageName string, auth *RegistryAuth) (string, error) {
+	domain := registryDomain(imageName)
+
+	if auth == nil {
+		for i := range d.registries {
+			if normalizeRegistryServer(d.registries[i].Server) == domain {
+				auth = &d.registries[i]
+				break
+			}
+		}
+	}
+
+	if auth == nil {
+		return "", nil
+	}
+
+	server := auth.Server
+	if server == "" {
+		server = domain
+	}
+
+	return registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      auth.Username,
+		Password:      auth.Password,
+		IdentityToken: auth.IdentityToken,
+		ServerAddress: server,
+	})
+}
+
+// returns the registry domain of an image reference, docker.io for docker hub images
+func registryDomain(imageName string) string {
+	named, err := reference.ParseNormalizedNamed(imageName)
+	if err != nil {
+		return ""
+	}
+
+	return reference.Domain(named)
+}
+
+func normalizeRegistryServer(server string) string {
+	server = strings.TrimPrefix(server, "https://")
+	server = strings.TrimPrefix(server, "http://")
+	server = strings.Split(server, "/")[0]
+
+	switch server {
+	case "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+
+	return server
+}
+
+// the daemon does not return typed errors for failed registry logins, so the
+// message has to be checked. Docker hub answers "pull access denied ... repository
+// does not exist or may require 'docker login'" for missing images as well as for
+// missing credentials, so this is reported as authentication error and only a
+// missing manifest counts as image not found
+func wrapPullError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"pull access denied", "unauthorized", "authentication required", "denied:", "no basic auth credentials"} {
+		if strings.Contains(msg, s) {
+			return fmt.Errorf("%w: %v", ErrRegistryAuth, err)
+		}
+	}
+
+	if strings.Contains(msg, "manifest unknown") || manifestNotFound.MatchString(msg) {
+		return fmt.Errorf("%w: %v", ErrImageNotFound, err)
+	}
+
+	return err
+}
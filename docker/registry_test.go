@@ -0,0 +1,40 @@
+package docker
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWrapPullError(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want error
+	}{
+		{"Error response from daemon: pull access denied for private/app, repository does not exist or may require 'docker login': denied: requested access to the resource is denied", ErrRegistryAuth},
+		{"Error response from daemon: Head \"https://registry.example.com/v2/app/manifests/latest\": no basic auth credentials", ErrRegistryAuth},
+		{"Error response from daemon: Head \"https://ghcr.io/v2/org/app/manifests/1.0\": unauthorized", ErrRegistryAuth},
+		{"Error response from daemon: Get \"https://registry.example.com/v2/\": unauthorized: authentication required", ErrRegistryAuth},
+		{"Error response from daemon: Head \"https://registry.gitlab.com/v2/org/app/manifests/1.0\": denied: access forbidden", ErrRegistryAuth},
+		{"Error response from daemon: manifest for nginx:doesnotexist not found: manifest unknown: manifest unknown", ErrImageNotFound},
+		{"Error response from daemon: manifest unknown: manifest unknown", ErrImageNotFound},
+		{"Error response from daemon: Get \"https://registry.example.com/v2/\": dial tcp: lookup registry.example.com: no such host", nil},
+		{"Error response from daemon: Get \"https://registry-1.docker.io/v2/\": net/http: request canceled while waiting for connection", nil},
+	}
+
+	for _, tt := range tests {
+		err := wrapPullError(errors.New(tt.msg))
+		if err == nil {
+			t.Fatalf("%q: got nil error", tt.msg)
+		}
+
+		for _, target := range []error{ErrRegistryAuth, ErrImageNotFound} {
+			if errors.Is(err, target) != (target == tt.want) {
+				t.Errorf("%q: errors.Is(%v) = %v", tt.msg, target, !(target == tt.want))
+			}
+		}
+	}
+
+	if wrapPullError(nil) != nil {
+		t.Error("nil error must stay nil")
+	}
+}
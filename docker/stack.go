@@ -0,0 +1,321 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+)
+
+// labels set on all resources of a stack
+const (
+	LABEL_STACK         = "mqtt-docker-sdk.stack"
+	LABEL_STACK_SERVICE = "mqtt-docker-sdk.stack-service"
+)
+
+// name of the network every service of a stack is attached to if it does not
+// list its own networks
+const STACK_DEFAULT_NETWORK = "default"
+
+// group of containers which are deployed together. Networks and volumes are created
+// with the stack name as prefix (<stack>_<name>), the default network is always created
+type Stack struct {
+	Name     string
+	Services map[string]StackService
+	Networks []string
+	Volumes  []string
+}
+
+type StackService struct {
+	// ContainerName, Network and Aliases are set by StackDeploy, volumes whose source is
+	// declared in the stack are mounted as named volumes prefixed with the stack name
+	Spec      ContainerSpec
+	DependsOn []string
+	Networks  []string //stack networks of the service, default network if empty
+}
+
+type StackServiceStatus struct {
+	Service       string `json:"service"`
+	ContainerName string `json:"containerName"`
+	ContainerId   string `json:"containerId,omitempty"`
+	State         string `json:"state"`
+	Status        string `json:"status,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// returns the services in the order they have to be started so every service is
+// started after the services it depends on
+func StackOrder(services map[string]StackService) ([]string, error) {
+	names := make([]string, 0, len(services))
+	for name, service := range services {
+		names = append(names, name)
+		for _, dep := range service.DependsOn {
+			if _, ok := services[dep]; !ok {
+				return nil, fmt.Errorf("service %s depends on unknown service %s", name, dep)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	order := make([]string, 0, len(names))
+	state := make(map[string]int) //0: not visited, 1: visiting, 2: done
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("dependency cycle %s", strings.Join(append(path, name), " -> "))
+		case 2:
+			return nil
+		}
+
+		state[name] = 1
+		deps := append([]string{}, services[name].DependsOn...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+func StackResourceName(stack, name string) string {
+	return stack + "_" + name
+}
+
+// deploy all services of the stack in dependency order. Existing containers of the stack
+// are removed first, so a deploy always results in the exact state of the stack definition.
+// Deployment stops at the first service which fails, the returned status contains the error
+func (d *Docker) StackDeploy(stack *Stack) ([]StackServiceStatus, error) {
+	ctx := context.Background()
+
+	order, err := StackOrder(stack.Services)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{
+		LABEL_MANAGED: "true",
+		LABEL_STACK:   stack.Name,
+	}
+
+	networks := append([]string{STACK_DEFAULT_NETWORK}, stack.Networks...)
+	for _, name := range networks {
+		err := d.stackNetworkCreate(ctx, StackResourceName(stack.Name, name), labels)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	volumes := make(map[string]bool)
+	for _, name := range stack.Volumes {
+		volumes[name] = true
+		_, err := d.dockerClient.VolumeCreate(ctx, volume.CreateOptions{
+			Name:   StackResourceName(stack.Name, name),
+			Labels: labels,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = d.stackContainersRemove(ctx, stack.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]StackServiceStatus, 0, len(order))
+	failed := false
+	for _, name := range order {
+		service := stack.Services[name]
+		status := StackServiceStatus{
+			Service:       name,
+			ContainerName: StackResourceName(stack.Name, name),
+			State:         "created",
+		}
+
+		if failed {
+			status.State = "skipped"
+			result = append(result, status)
+			continue
+		}
+
+		serviceNetworks := service.Networks
+		if len(serviceNetworks) == 0 {
+			serviceNetworks = []string{STACK_DEFAULT_NETWORK}
+		}
+
+		spec := service.Spec
+		spec.ContainerName = status.ContainerName
+		spec.Network = StackResourceName(stack.Name, serviceNetworks[0])
+		spec.Aliases = []string{name}
+		spec.Labels = make(map[string]string)
+		for k, v := range service.Spec.Labels {
+			spec.Labels[k] = v
+		}
+		for k, v := range labels {
+			spec.Labels[k] = v
+		}
+		spec.Labels[LABEL_STACK_SERVICE] = name
+
+		//volumes declared in the stack are named volumes, everything else is a bind mount
+		spec.Volumes = make([]string, 0, len(service.Spec.Volumes))
+		spec.NamedVolumes = append([]string{}, service.Spec.NamedVolumes...)
+		for _, v := range service.Spec.Volumes {
+			tmp := strings.SplitN(v, ":", 2)
+			if volumes[tmp[0]] {
+				spec.NamedVolumes = append(spec.NamedVolumes, StackResourceName(stack.Name, v))
+				continue
+			}
+			spec.Volumes = append(spec.Volumes, v)
+		}
+
+		id, _, err := d.ContainerCreateAndStart(&spec)
+		if err == nil {
+			for _, net := range serviceNetworks[1:] {
+				err = d.dockerClient.NetworkConnect(ctx, StackResourceName(stack.Name, net), id, &network.EndpointSettings{
+					Aliases: []string{name},
+				})
+				if err != nil {
+					break
+				}
+			}
+		}
+
+		status.ContainerId = id
+		if err != nil {
+			status.State = "failed"
+			status.Error = err.Error()
+			failed = true
+		} else {
+			status.State = "running"
+		}
+		result = append(result, status)
+	}
+
+	if failed {
+		return result, fmt.Errorf("deployment of stack %s failed", stack.Name)
+	}
+
+	return result, nil
+}
+
+// remove all containers and networks of the stack and its volumes if removeVolumes is set.
+// Returns the names of the removed containers
+func (d *Docker) StackRemove(name string, removeVolumes bool) ([]string, error) {
+	ctx := context.Background()
+
+	removed, err := d.stackContainersRemove(ctx, name)
+	if err != nil {
+		return removed, err
+	}
+
+	args := filters.NewArgs()
+	args.Add("label", LABEL_STACK+"="+name)
+
+	networks, err := d.dockerClient.NetworkList(ctx, types.NetworkListOptions{Filters: args})
+	if err != nil {
+		return removed, err
+	}
+	for _, n := range networks {
+		err = d.dockerClient.NetworkRemove(ctx, n.ID)
+		if err != nil {
+			return removed, err
+		}
+	}
+
+	if removeVolumes {
+		volumes, err := d.dockerClient.VolumeList(ctx, volume.ListOptions{Filters: args})
+		if err != nil {
+			return removed, err
+		}
+		for _, v := range volumes.Volumes {
+			err = d.dockerClient.VolumeRemove(ctx, v.Name, true)
+			if err != nil {
+				return removed, err
+			}
+		}
+	}
+
+	return removed, nil
+}
+
+// returns the status of all containers of the stack
+func (d *Docker) StackStatus(name string) ([]StackServiceStatus, error) {
+	containers, err := d.ContainerList(ContainerFilter{Labels: []string{LABEL_STACK + "=" + name}})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]StackServiceStatus, 0, len(containers))
+	for _, c := range containers {
+		status := StackServiceStatus{
+			Service:     c.Labels[LABEL_STACK_SERVICE],
+			ContainerId: c.ID,
+			State:       c.State,
+			Status:      c.Status,
+		}
+		if len(c.Names) > 0 {
+			status.ContainerName = c.Names[0]
+		}
+		result = append(result, status)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Service < result[j].Service
+	})
+
+	return result, nil
+}
+
+func (d *Docker) stackContainersRemove(ctx context.Context, name string) ([]string, error) {
+	containers, err := d.ContainerList(ContainerFilter{Labels: []string{LABEL_STACK + "=" + name}})
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	for _, c := range containers {
+		err := d.ContainerRemove(c.ID, true, false)
+		if err != nil {
+			return removed, err
+		}
+		if len(c.Names) > 0 {
+			removed = append(removed, c.Names[0])
+		}
+	}
+
+	return removed, nil
+}
+
+func (d *Docker) stackNetworkCreate(ctx context.Context, name string, labels map[string]string) error {
+	_, err := d.dockerClient.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+	if err == nil {
+		return nil
+	}
+
+	_, err = d.dockerClient.NetworkCreate(ctx, name, types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+		Labels:         labels,
+	})
+
+	return err
+}
@@ -0,0 +1,38 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStackOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		services map[string][]string
+		want     []string
+		wantErr  bool
+	}{
+		{"independent", map[string][]string{"b": nil, "a": nil}, []string{"a", "b"}, false},
+		{"chain", map[string][]string{"web": {"api"}, "api": {"db"}, "db": nil}, []string{"db", "api", "web"}, false},
+		{"shared", map[string][]string{"a": {"db", "cache"}, "b": {"db"}, "cache": nil, "db": nil}, []string{"cache", "db", "a", "b"}, false},
+		{"unknown", map[string][]string{"web": {"api"}}, nil, true},
+		{"self", map[string][]string{"web": {"web"}}, nil, true},
+		{"cycle", map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}}, nil, true},
+	}
+
+	for _, tt := range tests {
+		services := map[string]StackService{}
+		for name, deps := range tt.services {
+			services[name] = StackService{DependsOn: deps}
+		}
+
+		got, err := StackOrder(services)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// resource usage of a container computed from the docker stats api
+type ContainerStatsData struct {
+	ID            string    `json:"containerId"`
+	Name          string    `json:"name"`
+	Read          time.Time `json:"read"`
+	CpuPercent    float64   `json:"cpuPercent"`
+	MemoryUsage   uint64    `json:"memoryUsage"` //bytes without page cache
+	MemoryLimit   uint64    `json:"memoryLimit"`
+	MemoryPercent float64   `json:"memoryPercent"`
+	NetworkRx     uint64    `json:"networkRx"` //bytes received on all interfaces
+	NetworkTx     uint64    `json:"networkTx"`
+	BlockRead     uint64    `json:"blockRead"` //bytes read from block devices
+	BlockWrite    uint64    `json:"blockWrite"`
+	Pids          uint64    `json:"pids"`
+}
+
+// get a single stats sample of the container
+func (d *Docker) ContainerStats(containerId string) (*ContainerStatsData, error) {
+	ctx := context.Background()
+
+	//stream=false makes docker collect two samples so the cpu usage can be computed
+	resp, err := d.dockerClient.ContainerStats(ctx, containerId, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	stats := types.StatsJSON{}
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &ContainerStatsData{
+		ID:          containerId,
+		Name:        strings.TrimPrefix(stats.Name, "/"),
+		Read:        stats.Read,
+		CpuPercent:  calculateCpuPercent(&stats),
+		MemoryUsage: calculateMemoryUsage(&stats.MemoryStats),
+		MemoryLimit: stats.MemoryStats.Limit,
+		Pids:        stats.PidsStats.Current,
+	}
+
+	if data.MemoryLimit > 0 {
+		data.MemoryPercent = float64(data.MemoryUsage) / float64(data.MemoryLimit) * 100.0
+	}
+
+	for _, network := range stats.Networks {
+		data.NetworkRx += network.RxBytes
+		data.NetworkTx += network.TxBytes
+	}
+
+	for _, entry := range stats.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			data.BlockRead += entry.Value
+		case "write":
+			data.BlockWrite += entry.Value
+		}
+	}
+
+	return data, nil
+}
+
+// same calculation as the docker cli
+func calculateCpuPercent(stats *types.StatsJSON) float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+
+	onlineCpus := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCpus == 0 {
+		onlineCpus = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+
+	return cpuDelta / systemDelta * onlineCpus * 100.0
+}
+
+// memory usage without the page cache (cgroup v1 uses total_inactive_file,
+// cgroup v2 inactive_file)
+func calculateMemoryUsage(mem *types.MemoryStats) uint64 {
+	if v, ok := mem.Stats["total_inactive_file"]; ok && v < mem.Usage {
+		return mem.Usage - v
+	}
+
+	if v, ok := mem.Stats["inactive_file"]; ok && v < mem.Usage {
+		return mem.Usage - v
+	}
+
+	return mem.Usage
+}
@@ -7,9 +7,9 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"strings"
 	"time"
 
-	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/thomaskhub/mqtt-docker-sdk/client"
 	"github.com/thomaskhub/mqtt-docker-sdk/docker"
 	"github.com/thomaskhub/mqtt-docker-sdk/rpc"
@@ -19,6 +19,10 @@ import (
 
 var dockerClient docker.Docker = docker.Docker{}
 
+// agent version reported in the heartbeat, set at build time with
+// -ldflags "-X main.version=<version>"
+var version = "dev"
+
 func main() {
 
 	logger := utils.Logger{}
@@ -37,14 +41,29 @@ func main() {
 	}
 
 	// hostinfo, err := utils.ConvertHostInfoToJson()
-	hostinfoByte, hostinfoMap, err := utils.GetHostInfoByteAndMap()
+	_, hostinfoMap, err := utils.GetHostInfoByteAndMap()
 	if err != nil {
 		logger.Fatal("could not convert hostinfo to json", zap.Error(err))
 	}
 
 	cfg := utils.ParseConfig(*configFile)
-	cfg.Mqtt.BrokerSubscribeTopic = cfg.AppName + "/" + hostinfoMap["instance_id"].(string)
-	cfg.Mqtt.BrokerPublishTopic = cfg.AppName + "/cmd/" + hostinfoMap["instance_id"].(string)
+	topics, err := utils.NewTopics(
+		cfg.Mqtt.TopicTemplates(),
+		cfg.AppName,
+		hostinfoMap["instance_id"].(string),
+		hostinfoMap,
+	)
+	if err != nil {
+		logger.Fatal("invalid topic config", zap.Error(err))
+	}
+
+	if cfg.Mqtt.BrokerPublishTopic != "" || cfg.Mqtt.BrokerSubscribeTopic != "" {
+		//events and heartbeats used to be published on broker_publish_topic, they have their own topics now
+		logger.Warn("broker_publish_topic and broker_subscribe_topic are deprecated, use topics.response and topics.rpc instead. Events and heartbeats are no longer published on broker_publish_topic",
+			zap.String("event", topics.Topic(utils.TOPIC_CHANNEL_EVENT)),
+			zap.String("heartbeat", topics.Topic(utils.TOPIC_CHANNEL_HEARTBEAT)),
+		)
+	}
 
 	err = dockerClient.Init(
 		cfg.Docker.NetworkId,
@@ -56,6 +75,22 @@ func main() {
 		os.Exit(1)
 	}
 
+	registries := make([]docker.RegistryAuth, 0, len(cfg.Docker.Registries))
+	for _, reg := range cfg.Docker.Registries {
+		registries = append(registries, docker.RegistryAuth{
+			Server:        reg.Server,
+			Username:      reg.Username,
+			Password:      reg.Password,
+			IdentityToken: reg.IdentityToken,
+		})
+	}
+	dockerClient.SetRegistryAuth(registries)
+	dockerClient.SetInstance(cfg.AppName, hostinfoMap["instance_id"].(string))
+	err = dockerClient.SetEvents(cfg.Docker.Events)
+	if err != nil {
+		logger.Fatal("invalid docker events config", zap.Error(err))
+	}
+
 	//now create the network
 	_, _, err = dockerClient.NetworkCreate(
 		cfg.Docker.NetworkId,
@@ -67,65 +102,240 @@ func main() {
 		os.Exit(1)
 	}
 
+	//responses and events are buffered while the broker is not reachable
+	var outbox *client.Outbox
+	if cfg.Mqtt.OutboxMaxMessages > 0 {
+		outbox, err = client.NewOutbox(cfg.Mqtt.OutboxDir, cfg.Mqtt.OutboxMaxMessages, cfg.Mqtt.OutboxOverflow)
+		if err != nil {
+			logger.Fatal("could not create the outbox", zap.Error(err))
+		}
+	}
+
+	tlsConfig, err := client.NewTlsConfig(client.TlsOptions{
+		CaFile:     cfg.Mqtt.Tls.CaFile,
+		CertFile:   cfg.Mqtt.Tls.CertFile,
+		KeyFile:    cfg.Mqtt.Tls.KeyFile,
+		ServerName: cfg.Mqtt.Tls.ServerName,
+		MinVersion: cfg.Mqtt.Tls.MinVersion,
+	})
+	if err != nil {
+		logger.Fatal("invalid mqtt tls config", zap.Error(err))
+	}
+
+	//retained online/offline status, offline is sent by the broker as last will
+	online, err := json.Marshal(rpc.PresenceMessage{
+		Status:     rpc.PRESENCE_ONLINE,
+		InstanceId: hostinfoMap["instance_id"].(string),
+		Hostinfo:   utils.JsonCompatible(hostinfoMap),
+	})
+	if err != nil {
+		logger.Fatal("could not encode the presence message", zap.Error(err))
+	}
+	offline, _ := json.Marshal(rpc.PresenceMessage{
+		Status:     rpc.PRESENCE_OFFLINE,
+		InstanceId: hostinfoMap["instance_id"].(string),
+	})
+
 	//docker is now ready to be called via mqtt
-	client := client.NewMqttClientWithConfig(
-		cfg.Mqtt.Broker,
-		hostinfoMap["instance_id"].(string), //client id
+	mqttClient, err := client.NewMqttClientWithConfig(client.ClientConfig{
+		Broker:          cfg.Mqtt.Broker,
+		ClientId:        hostinfoMap["instance_id"].(string),
+		Username:        cfg.Mqtt.Username,
+		Password:        cfg.Mqtt.Password,
+		ProtocolVersion: cfg.Mqtt.ProtocolVersion,
+		Tls:             tlsConfig,
+		Presence: &client.Presence{
+			Topic:   topics.Topic(utils.TOPIC_CHANNEL_STATUS),
+			Online:  online,
+			Offline: offline,
+		},
+	})
+	if err != nil {
+		logger.Fatal("could not create the mqtt client", zap.Error(err))
+	}
 
-		cfg.Mqtt.Username,
-		cfg.Mqtt.Password,
-	)
+	if outbox != nil {
+		mqttClient.SetOutbox(outbox)
+	}
 
 	//Prepare RPC interface
 	r := rpc.Rpc{}
 	r.Init(utils.LOGGER_MODE_DEBUG, &dockerClient)
+	r.SetManagedOnly(cfg.Docker.ManagedOnly)
+	r.SetInstanceId(hostinfoMap["instance_id"].(string))
+	r.SetAgentVersion(version)
+	r.SetHeartbeatDiskPath(cfg.Mqtt.HeartbeatDiskPath)
 	r.AddHandler(rpc.RPC_METHOD_START_DOCKER, r.HandleStartDocker)
+	r.AddHandler(rpc.RPC_METHOD_STOP_DOCKER, r.HandleStopDocker)
+	r.AddHandler(rpc.RPC_METHOD_RESTART_DOCKER, r.HandleRestartDocker)
+	r.AddHandler(rpc.RPC_METHOD_PAUSE_DOCKER, r.HandlePauseDocker)
+	r.AddHandler(rpc.RPC_METHOD_UNPAUSE_DOCKER, r.HandleUnpauseDocker)
+	r.AddHandler(rpc.RPC_METHOD_KILL_DOCKER, r.HandleKillDocker)
+	r.AddHandler(rpc.RPC_METHOD_REMOVE_DOCKER, r.HandleRemoveDocker)
+	r.AddHandler(rpc.RPC_METHOD_LIST_CONTAINERS, r.HandleListContainers)
+	r.AddHandler(rpc.RPC_METHOD_INSPECT_CONTAINER, r.HandleInspectContainer)
+	r.AddHandler(rpc.RPC_METHOD_LOGS_DOCKER, r.HandleLogsDocker)
+	r.AddHandler(rpc.RPC_METHOD_CANCEL_LOGS, r.HandleCancelStream)
+	r.AddHandler(rpc.RPC_METHOD_EXEC_DOCKER, r.HandleExecDocker)
+	r.AddHandler(rpc.RPC_METHOD_CANCEL_EXEC, r.HandleCancelStream)
+	r.AddHandler(rpc.RPC_METHOD_STATS_DOCKER, r.HandleStatsDocker)
+	r.AddHandler(rpc.RPC_METHOD_PULL_IMAGE, r.HandlePullImage)
+	r.AddHandler(rpc.RPC_METHOD_LIST_IMAGES, r.HandleListImages)
+	r.AddHandler(rpc.RPC_METHOD_REMOVE_IMAGE, r.HandleRemoveImage)
+	r.AddHandler(rpc.RPC_METHOD_PRUNE_IMAGES, r.HandlePruneImages)
+	r.AddHandler(rpc.RPC_METHOD_SET_DESIRED_STATE, r.HandleSetDesiredState)
+	r.AddHandler(rpc.RPC_METHOD_GET_DESIRED_STATE, r.HandleGetDesiredState)
+	r.AddHandler(rpc.RPC_METHOD_DEPLOY_STACK, r.HandleDeployStack)
+	r.AddHandler(rpc.RPC_METHOD_REMOVE_STACK, r.HandleRemoveStack)
+	r.AddHandler(rpc.RPC_METHOD_STACK_STATUS, r.HandleStackStatus)
+
+	r.SetPublisher(topics, func(topic string, payload []byte) {
+		mqttClient.Publish(topic, payload, 1)
+	})
+
+	//the persisted desired state is loaded before any request or retained desired state
+	//document can arrive, so newer documents from the broker replace it
+	if cfg.Docker.DesiredStateFile != "" {
+		err = r.LoadDesiredState(cfg.Docker.DesiredStateFile)
+		if err != nil {
+			logger.Error("could not load desired state", zap.Error(err))
+		}
+	}
 
 	//this hangs until the broker becomes available
-	client.Connect()
+	mqttClient.Connect()
+
+	//v5 user properties and expiry of responses and events, ignored by v3 brokers
+	publishProperties := func(method string, correlationData []byte) *client.PublishProperties {
+		return &client.PublishProperties{
+			CorrelationData: correlationData,
+			UserProperties: map[string]string{
+				"method":      method,
+				"instance_id": hostinfoMap["instance_id"].(string),
+			},
+			MessageExpiry: cfg.Mqtt.MessageExpiry,
+		}
+	}
 
 	//handle rpc requests
-	rxMsg := func(c mqtt.Client, message mqtt.Message) {
+	rxMsg := func(message *client.Message) {
 
 		rpcReq := rpc.RpcReq{}
-		err := json.Unmarshal(message.Payload(), &rpcReq)
+		err := json.Unmarshal(message.Payload, &rpcReq)
 
 		if err != nil {
 			fmt.Printf("could not unmarshal rpc request: %v\n", err)
 			return
 		}
 
-		resp := r.HandleRpcCall(&rpcReq)
-		respString, _ := json.Marshal(resp)
-		if resp != nil {
-			client.Publish(cfg.Mqtt.BrokerPublishTopic, respString, 2)
+		//slow requests respond later from their own goroutine, so the next message
+		//is received right away
+		r.HandleRpcCallAsync(&rpcReq, func(resp *rpc.RpcResp) {
+			respString, _ := json.Marshal(resp)
+
+			//v5 requests may ask for the response on their own topic
+			respTopic := topics.Topic(utils.TOPIC_CHANNEL_RESPONSE)
+			if message.ResponseTopic != "" {
+				respTopic = message.ResponseTopic
+			}
+
+			mqttClient.PublishQueuedWithProperties(respTopic, respString, 2, publishProperties(rpcReq.Method, message.CorrelationData))
+		})
+	}
+
+	mqttClient.Subscribe(topics.Topic(utils.TOPIC_CHANNEL_RPC), rxMsg, 2)
+
+	//fleet wide requests, responses are published on the topic of the instance
+	if cfg.Mqtt.Broadcast {
+		mqttClient.Subscribe(topics.Topic(utils.TOPIC_CHANNEL_BROADCAST), rxMsg, 2)
+	}
+
+	groups := append([]string{}, cfg.Mqtt.Groups...)
+	for _, field := range cfg.Mqtt.GroupFields {
+		if value, ok := hostinfoMap[field]; ok && value != nil {
+			groups = append(groups, fmt.Sprint(value))
+		}
+	}
+	for _, group := range groups {
+		if group == "" || strings.ContainsAny(group, "+#") {
+			logger.Error("invalid group name", zap.String("group", group))
+			continue
+		}
+		mqttClient.Subscribe(topics.GroupTopic(group), rxMsg, 2)
+	}
+
+	//desired state documents can also be published (retained) on their own topic
+	rxDesiredState := func(message *client.Message) {
+		state := rpc.DesiredState{}
+		err := json.Unmarshal(message.Payload, &state)
+		if err != nil {
+			logger.Error("could not unmarshal desired state", zap.Error(err))
+			return
+		}
+
+		err = r.SetDesiredState(&state)
+		if err != nil {
+			logger.Error("invalid desired state", zap.Error(err))
 		}
 	}
 
-	client.Subscribe(cfg.Mqtt.BrokerSubscribeTopic, rxMsg, 2)
+	mqttClient.Subscribe(topics.Topic(utils.TOPIC_CHANNEL_DESIRED_STATE), rxDesiredState, 2)
+
+	// Desired state reconciliation
+	reconcileInterval := cfg.Docker.ReconcileInterval
+	if reconcileInterval <= 0 {
+		reconcileInterval = 30
+	}
 
-	eventsChannel := make(chan *rpc.RpcReq)
+	//docker and reconciler events are queued while the broker is not reachable
+	publishEvent := func(event *rpc.EventMessage) {
+		jsonData, _ := json.Marshal(event)
+		mqttClient.PublishQueuedWithProperties(topics.Topic(utils.TOPIC_CHANNEL_EVENT), jsonData, 2, publishProperties(event.Event, nil))
+	}
+	r.SetEventPublisher(publishEvent)
+
+	go r.RunReconciler(time.Duration(reconcileInterval) * time.Second)
+
+	eventsChannel := make(chan *rpc.EventMessage)
 	r.HandleEventDocker(eventsChannel)
 	go func() {
 		for {
 			select {
 			case event := <-eventsChannel:
-				jsonData, _ := json.Marshal(event)
-				client.Publish(cfg.Mqtt.BrokerPublishTopic, jsonData, 2)
+				publishEvent(event)
 			}
 		}
 	}()
 
 	// Heartbeat
 	go func() {
-		//send hostinfo every 30 seconds
+		//send hostinfo and live metrics every heartbeat_interval seconds
 		ticker := time.NewTicker(time.Duration(cfg.Mqtt.HeartBeatInterval) * time.Second)
+		hostinfo := utils.JsonCompatible(hostinfoMap)
 
 		for {
 			<-ticker.C
-			client.Publish(cfg.Mqtt.BrokerPublishTopic, hostinfoByte, 2)
+			msg := r.NewHeartbeat(hostinfo)
+			if outbox != nil {
+				msg.Outbox = mqttClient.OutboxStats()
+			}
+
+			heartbeat, err := json.Marshal(msg)
+			if err != nil {
+				logger.Error("could not encode the heartbeat", zap.Error(err))
+				continue
+			}
+			mqttClient.Publish(topics.Topic(utils.TOPIC_CHANNEL_HEARTBEAT), heartbeat, 2)
 		}
 	}()
 
+	// Container stats
+	if cfg.Mqtt.EnableStats && cfg.Mqtt.StatsInterval > 0 {
+		go r.PublishStats(
+			topics.Topic(utils.TOPIC_CHANNEL_STATS),
+			time.Duration(cfg.Mqtt.StatsInterval)*time.Second,
+		)
+	}
+
 	select {}
 }
@@ -0,0 +1,51 @@
+package rpc
+
+// maximum number of serial requests waiting for the worker, further requests
+// block the caller until the worker catches up
+const RPC_MAX_QUEUED_JOBS = 64
+
+// handle the request and pass the response to respond. Unlike HandleRpcCall this does
+// not block on slow requests, container and stack changes are queued and run one after
+// another in the order they were received, waiting for health checks and exec run in
+// their own goroutine. The response of these requests is passed to respond once they
+// are done, so respond must be safe for concurrent use
+func (r *Rpc) HandleRpcCallAsync(req *RpcReq, respond func(*RpcResp)) {
+	req.respond = func(resp *RpcResp) {
+		respond(r.finishResp(resp))
+	}
+
+	resp := r.HandleRpcCall(req)
+	if resp != nil {
+		respond(resp)
+	}
+}
+
+// run fn in the background if the request was received through HandleRpcCallAsync and
+// pass its response to the responder, nil is returned in this case. Serial requests are
+// run by the worker in the order they were queued, others in their own goroutine.
+// Without responder fn is run right away and its response is returned
+func (r *Rpc) respondAsync(req *RpcReq, serial bool, fn func() *RpcResp) *RpcResp {
+	if req.respond == nil {
+		return fn()
+	}
+
+	job := func() {
+		if resp := fn(); resp != nil {
+			req.respond(resp)
+		}
+	}
+
+	if serial {
+		r.jobs <- job
+	} else {
+		go job()
+	}
+
+	return nil
+}
+
+func (r *Rpc) runJobs() {
+	for job := range r.jobs {
+		job()
+	}
+}
@@ -1,8 +1,13 @@
 package rpc
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/thomaskhub/mqtt-docker-sdk/docker"
 	"go.uber.org/zap"
@@ -11,10 +16,6 @@ import (
 var startLock sync.Mutex
 
 func (r *Rpc) HandleStartDocker(req *RpcReq) *RpcResp {
-	//Ensure that we can call this only one after another
-	startLock.Lock()
-	defer startLock.Unlock()
-
 	r.logger.Debug("Handle the start of the docker container", zap.Any("request", req.Params))
 
 	params := &RpcStartDockerParams{}
@@ -64,42 +65,100 @@ func (r *Rpc) HandleStartDocker(req *RpcReq) *RpcResp {
 	// 	}
 	// }
 
-	//check if the docker image exists throw an error. Its the callers responsibiliry
-	//to ensure they only call images available on the system
-	imageExists := r.dockerClient.ImageExists(params.ImageName)
-	if !imageExists {
-		return &RpcResp{
+	err = params.validate()
+	if err != nil {
+		return newErrResp(req, RPC_ERR_CODE_INVALID_PARAMETERS, err.Error())
+	}
+
+	//containers are created one after another, the request is queued behind the
+	//running container and stack changes
+	return r.respondAsync(req, true, func() *RpcResp {
+		return r.startDocker(req, params)
+	})
+}
+
+func (r *Rpc) startDocker(req *RpcReq, params *RpcStartDockerParams) *RpcResp {
+	result, errResp := r.createDocker(req, params)
+	if errResp != nil {
+		return errResp
+	}
+
+	//waiting for the health check must not block the following container changes
+	if params.WaitHealthy {
+		return r.respondAsync(req, false, func() *RpcResp {
+			return r.waitHealthy(req, params, result)
+		})
+	}
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result:  result,
+	}
+}
+
+func (r *Rpc) createDocker(req *RpcReq, params *RpcStartDockerParams) (StartDockerResult, *RpcResp) {
+	startLock.Lock()
+	defer startLock.Unlock()
+
+	//
+	// Configure and Create the container, hock it up to the network and start its
+	//
+	spec := params.toSpec()
+	spec.Labels = map[string]string{
+		docker.LABEL_REQUEST_ID: strconv.Itoa(req.Id),
+	}
+
+	id, warnings, err := r.dockerClient.ContainerCreateAndStart(spec)
+
+	if errors.Is(err, docker.ErrRegistryAuth) {
+		return StartDockerResult{}, newErrResp(req, RPC_ERR_CODE_REGISTRY_AUTH, err.Error())
+	}
+
+	if errors.Is(err, docker.ErrImageNotFound) {
+		return StartDockerResult{}, newErrResp(req, RPC_ERR_CODE_DOCKER_IMAGE_NOT_FOUND, err.Error())
+	}
+
+	if errors.Is(err, docker.ErrImagePull) {
+		return StartDockerResult{}, newErrResp(req, RPC_ERR_CODE_IMAGE_PULL_FAILED, err.Error())
+	}
+
+	if err != nil {
+		return StartDockerResult{}, &RpcResp{
 			Id:      req.Id,
 			Jsonrpc: "2.0",
 			Error: &RpcErr{
-				Code:  RPC_ERR_CODE_DOCKER_IMAGE_NOT_FOUND,
-				Error: "could not clonde specified git repository",
+				Code:  RCP_ERR_CODE_INTERNAL_ERROR,
+				Error: err.Error(),
 			},
 		}
 	}
 
-	//
-	// Configure and Create the container, hock it up to the network and start its
-	//
-	id, warnings, err := r.dockerClient.ContainerCreateAndStart(
-		params.ImageName,
-		params.User,
-		params.ContainerName,
-		params.Restart,
-		"", //ip address will not be used from docker start job as of know
-		params.Ports,
-		params.Volumes,
-		params.Environment,
-		params.Commands,
-	)
+	return StartDockerResult{
+		ContainerId: id,
+		Warnings:    warnings,
+	}, nil
+}
 
+func (r *Rpc) waitHealthy(req *RpcReq, params *RpcStartDockerParams, result StartDockerResult) *RpcResp {
+	timeout := 60 * time.Second
+	if params.WaitTimeout > 0 {
+		timeout = time.Duration(params.WaitTimeout) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	health, err := r.dockerClient.ContainerWaitHealthy(ctx, result.ContainerId)
+	result.Health = health
 	if err != nil {
 		return &RpcResp{
 			Id:      req.Id,
 			Jsonrpc: "2.0",
 			Error: &RpcErr{
-				Code:  RCP_ERR_CODE_INTERNAL_ERROR,
+				Code:  RPC_ERR_CODE_CONTAINER_UNHEALTHY,
 				Error: err.Error(),
+				Data:  result, //json rpc does not allow result and error together
 			},
 		}
 	}
@@ -107,14 +166,285 @@ func (r *Rpc) HandleStartDocker(req *RpcReq) *RpcResp {
 	return &RpcResp{
 		Id:      req.Id,
 		Jsonrpc: "2.0",
-		Result: StartDockerResult{
+		Result:  result,
+	}
+}
+
+func (r *Rpc) HandleStopDocker(req *RpcReq) *RpcResp {
+	return r.respondAsync(req, true, func() *RpcResp {
+		return r.stopDocker(req)
+	})
+}
+
+func (r *Rpc) stopDocker(req *RpcReq) *RpcResp {
+	startLock.Lock()
+	defer startLock.Unlock()
+
+	r.logger.Debug("Handle the stop of the docker container", zap.Any("request", req.Params))
+
+	params := &RpcStopDockerParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	state, id, errResp := r.findContainer(req, params.ContainerName)
+	if errResp != nil {
+		return errResp
+	}
+
+	//docker stops paused containers as well
+	if docker.ContainerActive(state) {
+		err := r.dockerClient.ContainerStop(id, params.Timeout, params.Signal)
+		if err != nil {
+			return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+		}
+	}
+
+	if params.Remove {
+		err := r.dockerClient.ContainerRemove(id, false, false)
+		if err != nil {
+			return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+		}
+	}
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result: StopDockerResult{
 			ContainerId: id,
-			Warnings:    warnings,
+			Stopped:     true,
+			Removed:     params.Remove,
 		},
 	}
 }
 
-func (r *Rpc) HandleEventDocker(resp chan *RpcReq) *RpcReq {
+func (r *Rpc) HandleRestartDocker(req *RpcReq) *RpcResp {
+	return r.respondAsync(req, true, func() *RpcResp {
+		return r.restartDocker(req)
+	})
+}
+
+func (r *Rpc) restartDocker(req *RpcReq) *RpcResp {
+	startLock.Lock()
+	defer startLock.Unlock()
+
+	params := &RpcRestartDockerParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	_, id, errResp := r.findContainer(req, params.ContainerName)
+	if errResp != nil {
+		return errResp
+	}
+
+	err := r.dockerClient.ContainerRestart(id, params.Timeout, params.Signal)
+	if err != nil {
+		return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+	}
+
+	return r.containerStateResp(req, id)
+}
+
+func (r *Rpc) HandlePauseDocker(req *RpcReq) *RpcResp {
+	params := &RpcContainerParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	_, id, errResp := r.findContainer(req, params.ContainerName)
+	if errResp != nil {
+		return errResp
+	}
+
+	err := r.dockerClient.ContainerPause(id)
+	if err != nil {
+		return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+	}
+
+	return r.containerStateResp(req, id)
+}
+
+func (r *Rpc) HandleUnpauseDocker(req *RpcReq) *RpcResp {
+	params := &RpcContainerParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	_, id, errResp := r.findContainer(req, params.ContainerName)
+	if errResp != nil {
+		return errResp
+	}
+
+	err := r.dockerClient.ContainerUnpause(id)
+	if err != nil {
+		return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+	}
+
+	return r.containerStateResp(req, id)
+}
+
+func (r *Rpc) HandleKillDocker(req *RpcReq) *RpcResp {
+	params := &RpcKillDockerParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	_, id, errResp := r.findContainer(req, params.ContainerName)
+	if errResp != nil {
+		return errResp
+	}
+
+	err := r.dockerClient.ContainerKill(id, params.Signal)
+	if err != nil {
+		return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+	}
+
+	return r.containerStateResp(req, id)
+}
+
+func (r *Rpc) HandleRemoveDocker(req *RpcReq) *RpcResp {
+	return r.respondAsync(req, true, func() *RpcResp {
+		return r.removeDocker(req)
+	})
+}
+
+func (r *Rpc) removeDocker(req *RpcReq) *RpcResp {
+	startLock.Lock()
+	defer startLock.Unlock()
+
+	params := &RpcRemoveDockerParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	_, id, errResp := r.findContainer(req, params.ContainerName)
+	if errResp != nil {
+		return errResp
+	}
+
+	err := r.dockerClient.ContainerRemove(id, params.Force, params.RemoveVolumes)
+	if err != nil {
+		return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+	}
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result: ContainerStateResult{
+			ContainerId: id,
+			State:       "removed",
+		},
+	}
+}
+
+func (r *Rpc) HandleListContainers(req *RpcReq) *RpcResp {
+	params := &RpcListContainersParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	filter := docker.ContainerFilter{
+		Labels: params.Labels,
+		Name:   params.Name,
+		Image:  params.Image,
+		State:  params.State,
+	}
+	if r.managedOnly {
+		filter.Labels = append(filter.Labels, docker.LABEL_MANAGED+"=true")
+	}
+
+	containers, err := r.dockerClient.ContainerList(filter)
+	if err != nil {
+		return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+	}
+
+	result := ListContainersResult{
+		Containers: make([]ContainerListEntry, 0, len(containers)),
+	}
+	for _, c := range containers {
+		result.Containers = append(result.Containers, ContainerListEntry{
+			ContainerId: c.ID,
+			Names:       c.Names,
+			Image:       c.Image,
+			State:       c.State,
+			Status:      c.Status,
+			Ports:       c.Ports,
+			Labels:      c.Labels,
+			Created:     c.Created,
+		})
+	}
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result:  result,
+	}
+}
+
+func (r *Rpc) HandleInspectContainer(req *RpcReq) *RpcResp {
+	params := &RpcContainerParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	_, id, errResp := r.findContainer(req, params.ContainerName)
+	if errResp != nil {
+		return errResp
+	}
+
+	details, err := r.dockerClient.ContainerInspect(id)
+	if err != nil {
+		return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+	}
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result:  details,
+	}
+}
+
+// looks up the container by its name. Returns the state of the container and its id
+// or the error response if the container does not exist or may not be accessed
+func (r *Rpc) findContainer(req *RpcReq, containerName string) (string, string, *RpcResp) {
+	if containerName == "" {
+		return "", "", newErrResp(req, RPC_ERR_CODE_INVALID_PARAMETERS, "containerName is required")
+	}
+
+	c, err := r.dockerClient.ContainerFind(containerName)
+	if err != nil {
+		return "", "", newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+	}
+
+	if c == nil {
+		return "", "", newErrResp(req, RPC_ERR_CODE_CONTAINER_NOT_FOUND, fmt.Sprintf("container %s not found", containerName))
+	}
+
+	if r.managedOnly && c.Labels[docker.LABEL_MANAGED] != "true" {
+		return "", "", newErrResp(req, RPC_ERR_CODE_CONTAINER_NOT_MANAGED, fmt.Sprintf("container %s is not managed by the agent", containerName))
+	}
+
+	return c.State, c.ID, nil
+}
+
+func (r *Rpc) containerStateResp(req *RpcReq, id string) *RpcResp {
+	state, err := r.dockerClient.ContainerState(id)
+	if err != nil {
+		return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+	}
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result: ContainerStateResult{
+			ContainerId: id,
+			State:       state,
+		},
+	}
+}
+
+func (r *Rpc) HandleEventDocker(resp chan *EventMessage) *RpcReq {
 	event := make(chan docker.ContainerEventData)
 	go r.dockerClient.ContainerEvents(event)
 
@@ -133,18 +463,29 @@ func (r *Rpc) HandleEventDocker(resp chan *RpcReq) *RpcReq {
 		for {
 			lastContainerEventData := <-event
 
-			resp <- &RpcReq{
-				Id:      0,
-				Jsonrpc: "2.0",
-				Method:  EventMapping[lastContainerEventData.Status],
-				Params: EventsDockerResult{
-					ContainerId: lastContainerEventData.ID,
-					Image:       lastContainerEventData.Image,
-					Name:        lastContainerEventData.Name,
-					Status:      lastContainerEventData.Status,
-					ExitCode:    lastContainerEventData.ExitCode,
-				},
+			key := lastContainerEventData.Status
+			if lastContainerEventData.Type != "container" {
+				key = lastContainerEventData.Type + "_" + key
 			}
+
+			method, ok := EventMapping[key]
+			if !ok {
+				method = "docker_event_" + key
+			}
+
+			resp <- r.NewEvent(method, EventsDockerResult{
+				Type:        lastContainerEventData.Type,
+				ContainerId: lastContainerEventData.ID,
+				Image:       lastContainerEventData.Image,
+				Name:        lastContainerEventData.Name,
+				Status:      lastContainerEventData.Status,
+				Health:      lastContainerEventData.Health,
+				ExitCode:    lastContainerEventData.ExitCode,
+				Signal:      lastContainerEventData.Signal,
+				Network:     lastContainerEventData.Network,
+				Labels:      lastContainerEventData.Labels,
+				Error:       lastContainerEventData.Error,
+			})
 		}
 	}()
 	return nil
@@ -0,0 +1,157 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/thomaskhub/mqtt-docker-sdk/docker"
+	"github.com/thomaskhub/mqtt-docker-sdk/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	EXEC_DEFAULT_TIMEOUT = 60 * time.Second
+	EXEC_MAX_OUTPUT      = 1024 * 1024 //max captured bytes per output stream
+)
+
+// run a command inside a running container. Without stream the call blocks until the
+// command exits and returns the captured output, with stream the output is published
+// on a dedicated topic and the stream id is returned right away
+func (r *Rpc) HandleExecDocker(req *RpcReq) *RpcResp {
+	params := &RpcExecDockerParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	if len(params.Cmd) == 0 {
+		return newErrResp(req, RPC_ERR_CODE_INVALID_PARAMETERS, "cmd is required")
+	}
+
+	state, id, errResp := r.findContainer(req, params.ContainerName)
+	if errResp != nil {
+		return errResp
+	}
+
+	if state != "running" {
+		return newErrResp(req, RPC_ERR_CODE_CONTAINER_NOT_RUNNING, "container is not running")
+	}
+
+	opts := docker.ExecOptions{
+		Cmd:        params.Cmd,
+		User:       params.User,
+		Env:        params.Env,
+		WorkingDir: params.WorkingDir,
+	}
+
+	if params.Stream {
+		return r.execStream(req, id, opts, params.StreamId)
+	}
+
+	//the command may run up to the timeout, this must not block other requests
+	return r.respondAsync(req, false, func() *RpcResp {
+		return r.exec(req, id, opts, params.Timeout)
+	})
+}
+
+// run the command and return its captured output once it exits or the timeout (seconds)
+// is reached
+func (r *Rpc) exec(req *RpcReq, id string, opts docker.ExecOptions, timeoutSec int) *RpcResp {
+	timeout := EXEC_DEFAULT_TIMEOUT
+	if timeoutSec > 0 {
+		timeout = time.Duration(timeoutSec) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stdout := &limitedBuffer{limit: EXEC_MAX_OUTPUT}
+	stderr := &limitedBuffer{limit: EXEC_MAX_OUTPUT}
+
+	exitCode, err := r.dockerClient.ContainerExec(ctx, id, opts, stdout, stderr)
+	if err != nil {
+		return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+	}
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result: ExecDockerResult{
+			ExitCode:  exitCode,
+			Stdout:    stdout.buf.String(),
+			Stderr:    stderr.buf.String(),
+			Truncated: stdout.truncated || stderr.truncated,
+		},
+	}
+}
+
+func (r *Rpc) execStream(req *RpcReq, id string, opts docker.ExecOptions, streamId string) *RpcResp {
+	streamId, topic, ctx, errResp := r.startStream(req, utils.TOPIC_CHANNEL_EXEC, streamId)
+	if errResp != nil {
+		return errResp
+	}
+
+	go func() {
+		defer r.stopStream(streamId)
+
+		stdout := &streamWriter{r: r, topic: topic, streamId: streamId, stream: docker.LOG_STREAM_STDOUT}
+		stderr := &streamWriter{r: r, topic: topic, streamId: streamId, stream: docker.LOG_STREAM_STDERR}
+
+		exitCode, err := r.dockerClient.ContainerExec(ctx, id, opts, stdout, stderr)
+
+		msg := ExecStreamMessage{StreamId: streamId, Eof: true}
+		if err != nil {
+			r.logger.Error("exec stream failed", zap.String("stream", streamId), zap.Error(err))
+			msg.Error = err.Error()
+		} else {
+			msg.ExitCode = &exitCode
+		}
+		r.publishJson(topic, msg)
+	}()
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result: StreamResult{
+			StreamId: streamId,
+			Topic:    topic,
+		},
+	}
+}
+
+// publishes every chunk written to it as ExecStreamMessage
+type streamWriter struct {
+	r        *Rpc
+	topic    string
+	streamId string
+	stream   string
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.r.publishJson(w.topic, ExecStreamMessage{
+		StreamId: w.streamId,
+		Stream:   w.stream,
+		Data:     string(p),
+	})
+	return len(p), nil
+}
+
+// captures output up to limit bytes and silently drops the rest
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	free := b.limit - b.buf.Len()
+	if len(p) > free {
+		b.truncated = true
+		if free > 0 {
+			b.buf.Write(p[:free])
+		}
+		return len(p), nil
+	}
+
+	return b.buf.Write(p)
+}
@@ -0,0 +1,72 @@
+package rpc
+
+import (
+	"time"
+
+	"github.com/thomaskhub/mqtt-docker-sdk/docker"
+	"github.com/thomaskhub/mqtt-docker-sdk/utils"
+)
+
+// build the heartbeat with the static hostinfo and the live metrics of the host and
+// the docker engine. Metrics which can not be read are listed in Errors, the heartbeat
+// is sent anyway. Must not be called concurrently because the cpu usage is computed
+// from the previous call
+func (r *Rpc) NewHeartbeat(hostinfo interface{}) *HeartbeatMessage {
+	heartbeat := &HeartbeatMessage{
+		Type:         MESSAGE_TYPE_HEARTBEAT,
+		InstanceId:   r.instanceId,
+		Timestamp:    time.Now().UTC(),
+		AgentVersion: r.agentVersion,
+		Hostinfo:     hostinfo,
+	}
+
+	host, err := r.hostMetrics.Collect()
+	if err != nil {
+		heartbeat.Errors = append(heartbeat.Errors, "host: "+err.Error())
+	} else {
+		heartbeat.Host = host
+	}
+
+	if r.dockerClient == nil {
+		return heartbeat
+	}
+
+	info, err := r.dockerClient.EngineInfo()
+	if err != nil {
+		heartbeat.Errors = append(heartbeat.Errors, "docker: "+err.Error())
+		return heartbeat
+	}
+
+	heartbeat.Docker = &HeartbeatDocker{
+		EngineVersion: info.Version,
+		DataRoot:      info.RootDir,
+		Containers:    map[string]int{},
+	}
+
+	diskPath := r.diskPath
+	if diskPath == "" {
+		diskPath = info.RootDir
+	}
+
+	if diskPath != "" {
+		disk, err := utils.GetDiskUsage(diskPath)
+		if err != nil {
+			heartbeat.Errors = append(heartbeat.Errors, "disk: "+err.Error())
+		} else {
+			heartbeat.Docker.Disk = disk
+		}
+	}
+
+	containers, err := r.dockerClient.ContainerList(docker.ContainerFilter{
+		Labels: []string{docker.LABEL_MANAGED + "=true"},
+	})
+	if err != nil {
+		heartbeat.Errors = append(heartbeat.Errors, "containers: "+err.Error())
+	} else {
+		for _, c := range containers {
+			heartbeat.Docker.Containers[c.State]++
+		}
+	}
+
+	return heartbeat
+}
@@ -0,0 +1,138 @@
+package rpc
+
+import (
+	"errors"
+
+	"github.com/thomaskhub/mqtt-docker-sdk/docker"
+	"github.com/thomaskhub/mqtt-docker-sdk/utils"
+	"go.uber.org/zap"
+)
+
+// pull an image in the background. The layer progress and the final digest are
+// published on a dedicated topic which is returned to the caller
+func (r *Rpc) HandlePullImage(req *RpcReq) *RpcResp {
+	params := &RpcPullImageParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	if params.ImageName == "" {
+		return newErrResp(req, RPC_ERR_CODE_INVALID_PARAMETERS, "imageName is required")
+	}
+
+	streamId, topic, ctx, errResp := r.startStream(req, utils.TOPIC_CHANNEL_PULL, params.StreamId)
+	if errResp != nil {
+		return errResp
+	}
+
+	go func() {
+		defer r.stopStream(streamId)
+
+		progress := make(chan docker.PullProgress)
+		done := make(chan struct{})
+		digest := ""
+		var err error
+
+		go func() {
+			defer close(done)
+			digest, err = r.dockerClient.PullImageWithProgress(ctx, params.ImageName, params.RegistryAuth.toDocker(), progress)
+		}()
+
+		for {
+			select {
+			case p := <-progress:
+				r.publishJson(topic, PullImageStreamMessage{
+					StreamId: streamId,
+					Layer:    p.Layer,
+					Status:   p.Status,
+					Current:  p.Current,
+					Total:    p.Total,
+				})
+
+			case <-done:
+				msg := PullImageStreamMessage{StreamId: streamId, Eof: true, Digest: digest}
+				if err != nil {
+					r.logger.Error("pulling image failed", zap.String("image", params.ImageName), zap.Error(err))
+					msg.Error = err.Error()
+					msg.Code = RCP_ERR_CODE_INTERNAL_ERROR
+					if errors.Is(err, docker.ErrRegistryAuth) {
+						msg.Code = RPC_ERR_CODE_REGISTRY_AUTH
+					}
+					if errors.Is(err, docker.ErrImageNotFound) {
+						msg.Code = RPC_ERR_CODE_DOCKER_IMAGE_NOT_FOUND
+					}
+				}
+				r.publishJson(topic, msg)
+				return
+			}
+		}
+	}()
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result: StreamResult{
+			StreamId: streamId,
+			Topic:    topic,
+		},
+	}
+}
+
+func (r *Rpc) HandleListImages(req *RpcReq) *RpcResp {
+	images, err := r.dockerClient.ImageList()
+	if err != nil {
+		return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+	}
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result: ListImagesResult{
+			Images: images,
+		},
+	}
+}
+
+func (r *Rpc) HandleRemoveImage(req *RpcReq) *RpcResp {
+	params := &RpcRemoveImageParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	if params.ImageName == "" {
+		return newErrResp(req, RPC_ERR_CODE_INVALID_PARAMETERS, "imageName is required")
+	}
+
+	if !r.dockerClient.ImageExists(params.ImageName) {
+		return newErrResp(req, RPC_ERR_CODE_DOCKER_IMAGE_NOT_FOUND, "image not found")
+	}
+
+	result, err := r.dockerClient.ImageRemove(params.ImageName, params.Force, params.PruneChildren)
+	if err != nil {
+		return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+	}
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result:  result,
+	}
+}
+
+func (r *Rpc) HandlePruneImages(req *RpcReq) *RpcResp {
+	params := &RpcPruneImagesParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	result, err := r.dockerClient.ImagePrune(params.All, params.Labels)
+	if err != nil {
+		return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+	}
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result:  result,
+	}
+}
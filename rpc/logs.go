@@ -0,0 +1,72 @@
+package rpc
+
+import (
+	"github.com/thomaskhub/mqtt-docker-sdk/docker"
+	"github.com/thomaskhub/mqtt-docker-sdk/utils"
+	"go.uber.org/zap"
+)
+
+// start publishing the logs of a container. The lines are published asynchronously on
+// a dedicated topic which is returned to the caller, follow streams run until they are
+// canceled with cancel_logs or the container stops
+func (r *Rpc) HandleLogsDocker(req *RpcReq) *RpcResp {
+	params := &RpcLogsDockerParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	_, id, errResp := r.findContainer(req, params.ContainerName)
+	if errResp != nil {
+		return errResp
+	}
+
+	streamId, topic, ctx, errResp := r.startStream(req, utils.TOPIC_CHANNEL_LOGS, params.StreamId)
+	if errResp != nil {
+		return errResp
+	}
+
+	go func() {
+		defer r.stopStream(streamId)
+
+		lines := make(chan docker.LogLine)
+		done := make(chan error, 1)
+		go func() {
+			done <- r.dockerClient.ContainerLogs(ctx, id, docker.LogOptions{
+				Tail:   params.Tail,
+				Since:  params.Since,
+				Until:  params.Until,
+				Follow: params.Follow,
+			}, lines)
+		}()
+
+		for {
+			select {
+			case line := <-lines:
+				r.publishJson(topic, LogsStreamMessage{
+					StreamId:  streamId,
+					Stream:    line.Stream,
+					Timestamp: line.Timestamp,
+					Line:      line.Line,
+				})
+
+			case err := <-done:
+				msg := LogsStreamMessage{StreamId: streamId, Eof: true}
+				if err != nil {
+					r.logger.Error("reading container logs failed", zap.String("stream", streamId), zap.Error(err))
+					msg.Error = err.Error()
+				}
+				r.publishJson(topic, msg)
+				return
+			}
+		}
+	}()
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result: StreamResult{
+			StreamId: streamId,
+			Topic:    topic,
+		},
+	}
+}
@@ -0,0 +1,271 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/thomaskhub/mqtt-docker-sdk/docker"
+	"go.uber.org/zap"
+)
+
+// set the desired state of the instance. The reconciler creates missing containers,
+// recreates drifted ones and removes managed containers which are not part of it
+func (r *Rpc) HandleSetDesiredState(req *RpcReq) *RpcResp {
+	state := &DesiredState{}
+	if errResp := parseParams(req, state); errResp != nil {
+		return errResp
+	}
+
+	err := r.SetDesiredState(state)
+	if err != nil {
+		return newErrResp(req, RPC_ERR_CODE_INVALID_PARAMETERS, err.Error())
+	}
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result: SetDesiredStateResult{
+			Containers: len(state.Containers),
+		},
+	}
+}
+
+func (r *Rpc) HandleGetDesiredState(req *RpcReq) *RpcResp {
+	r.desiredLock.Lock()
+	state := r.desiredState
+	r.desiredLock.Unlock()
+
+	if state == nil {
+		state = &DesiredState{Containers: []RpcStartDockerParams{}}
+	}
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result:  state,
+	}
+}
+
+// validate and store the desired state and trigger a reconcile run. If a state file is
+// configured the state is persisted so it survives a restart of the agent
+func (r *Rpc) SetDesiredState(state *DesiredState) error {
+	names := make(map[string]bool)
+	for i := range state.Containers {
+		c := &state.Containers[i]
+		if c.ContainerName == "" {
+			return fmt.Errorf("containers[%d]: containerName is required", i)
+		}
+
+		if names[c.ContainerName] {
+			return fmt.Errorf("containers[%d]: duplicate containerName %s", i, c.ContainerName)
+		}
+		names[c.ContainerName] = true
+
+		if err := c.validate(); err != nil {
+			return fmt.Errorf("containers[%d]: %v", i, err)
+		}
+	}
+
+	r.desiredLock.Lock()
+	r.desiredState = state
+	file := r.desiredStateFile
+	r.desiredLock.Unlock()
+
+	if file != "" {
+		data, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+
+		err = os.WriteFile(file, data, 0600)
+		if err != nil {
+			r.logger.Error("could not persist desired state", zap.String("file", file), zap.Error(err))
+		}
+	}
+
+	select {
+	case r.reconcileTrigger <- struct{}{}:
+	default:
+		//a reconcile run is already pending
+	}
+
+	return nil
+}
+
+// set the file the desired state is persisted in and load the last state from it
+func (r *Rpc) LoadDesiredState(file string) error {
+	r.desiredLock.Lock()
+	r.desiredStateFile = file
+	r.desiredLock.Unlock()
+
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	state := &DesiredState{}
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return err
+	}
+
+	return r.SetDesiredState(state)
+}
+
+// reconcile the containers every interval and whenever a new desired state is set.
+// Nothing is done as long as no desired state was set
+func (r *Rpc) RunReconciler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.reconcileTrigger:
+		}
+
+		r.desiredLock.Lock()
+		state := r.desiredState
+		r.desiredLock.Unlock()
+
+		if state == nil {
+			continue
+		}
+
+		result := r.reconcile(state)
+		if len(result.Created)+len(result.Recreated)+len(result.Started)+len(result.Removed)+len(result.Errors) > 0 {
+			r.emitEvent(r.NewEvent(RPC_EVENT_RECONCILE_RESULT, result))
+		}
+	}
+}
+
+func (r *Rpc) reconcile(state *DesiredState) *ReconcileResult {
+	startLock.Lock()
+	defer startLock.Unlock()
+
+	result := &ReconcileResult{
+		Created:   []string{},
+		Recreated: []string{},
+		Started:   []string{},
+		Removed:   []string{},
+		Errors:    []ReconcileError{},
+	}
+
+	addErr := func(name string, err error) {
+		r.logger.Error("reconcile failed", zap.String("container", name), zap.Error(err))
+		result.Errors = append(result.Errors, ReconcileError{ContainerName: name, Error: err.Error()})
+	}
+
+	containers, err := r.dockerClient.ContainerList(docker.ContainerFilter{})
+	if err != nil {
+		addErr("", err)
+		return result
+	}
+
+	existing := make(map[string]docker.ContainerInfo)
+	for _, c := range containers {
+		for _, name := range c.Names {
+			existing[name] = c
+		}
+	}
+
+	desired := make(map[string]bool)
+	for i := range state.Containers {
+		params := state.Containers[i]
+		desired[params.ContainerName] = true
+
+		spec := params.toSpec()
+		hash := spec.Hash()
+		if spec.Labels == nil {
+			spec.Labels = make(map[string]string)
+		}
+		spec.Labels[docker.LABEL_DESIRED_STATE] = "true"
+
+		c, ok := existing[params.ContainerName]
+		if !ok {
+			_, _, err := r.dockerClient.ContainerCreateAndStart(spec)
+			if err != nil {
+				addErr(params.ContainerName, err)
+				continue
+			}
+			result.Created = append(result.Created, params.ContainerName)
+			continue
+		}
+
+		if c.Labels[docker.LABEL_DESIRED_STATE] != "true" {
+			addErr(params.ContainerName, fmt.Errorf("container name is used by a container not created from the desired state"))
+			continue
+		}
+
+		if c.Labels[docker.LABEL_SPEC_HASH] != hash {
+			r.publishDrift(params.ContainerName, c.ID, "spec changed")
+
+			err := r.dockerClient.ContainerRemove(c.ID, true, false)
+			if err != nil {
+				addErr(params.ContainerName, err)
+				continue
+			}
+
+			_, _, err = r.dockerClient.ContainerCreateAndStart(spec)
+			if err != nil {
+				addErr(params.ContainerName, err)
+				continue
+			}
+			result.Recreated = append(result.Recreated, params.ContainerName)
+			continue
+		}
+
+		if c.State != "running" && c.State != "restarting" {
+			r.publishDrift(params.ContainerName, c.ID, "container is "+c.State)
+
+			//paused containers can not be started
+			var err error
+			if c.State == "paused" {
+				err = r.dockerClient.ContainerUnpause(c.ID)
+			} else {
+				err = r.dockerClient.ContainerStart(c.ID)
+			}
+			if err != nil {
+				addErr(params.ContainerName, err)
+				continue
+			}
+			result.Started = append(result.Started, params.ContainerName)
+		}
+	}
+
+	//remove containers of a previous desired state which are not desired anymore, containers
+	//started with start_docker are left alone
+	for _, c := range containers {
+		if c.Labels[docker.LABEL_DESIRED_STATE] != "true" || len(c.Names) == 0 || desired[c.Names[0]] {
+			continue
+		}
+
+		//stacks are managed by deploy_stack and remove_stack
+		if c.Labels[docker.LABEL_STACK] != "" {
+			continue
+		}
+
+		r.publishDrift(c.Names[0], c.ID, "container is not part of the desired state")
+
+		err := r.dockerClient.ContainerRemove(c.ID, true, false)
+		if err != nil {
+			addErr(c.Names[0], err)
+			continue
+		}
+		result.Removed = append(result.Removed, c.Names[0])
+	}
+
+	return result
+}
+
+func (r *Rpc) publishDrift(name, id, reason string) {
+	r.emitEvent(r.NewEvent(RPC_EVENT_RECONCILE_DRIFT, ReconcileDrift{
+		ContainerName: name,
+		ContainerId:   id,
+		Reason:        reason,
+	}))
+}
@@ -1,28 +1,116 @@
 package rpc
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
+	"github.com/docker/go-units"
 	"github.com/thomaskhub/mqtt-docker-sdk/docker"
 	"github.com/thomaskhub/mqtt-docker-sdk/utils"
 )
 
 const (
-	CONTAINER_START  = "start"
-	CONTAINER_CREATE = "create"
-	CONTAINER_DIE    = "die"
+	CONTAINER_START         = "start"
+	CONTAINER_CREATE        = "create"
+	CONTAINER_DIE           = "die"
+	CONTAINER_STOP          = "stop"
+	CONTAINER_KILL          = "kill"
+	CONTAINER_OOM           = "oom"
+	CONTAINER_RESTART       = "restart"
+	CONTAINER_DESTROY       = "destroy"
+	CONTAINER_PAUSE         = "pause"
+	CONTAINER_UNPAUSE       = "unpause"
+	CONTAINER_HEALTH_STATUS = "health_status"
+
+	IMAGE_PULL   = "image_pull"
+	IMAGE_DELETE = "image_delete"
+
+	NETWORK_CONNECT    = "network_connect"
+	NETWORK_DISCONNECT = "network_disconnect"
+
+	DAEMON_DISCONNECTED = "daemon_disconnected"
+	DAEMON_RECONNECTED  = "daemon_reconnected"
 )
 
+// maps the docker events to the rpc method of the event notification. Container events
+// are keyed by their action, image, network and daemon events by <type>_<action>
 var EventMapping = map[string]string{
-	CONTAINER_START:  "docker_event_start",
-	CONTAINER_CREATE: "docker_event_create",
-	CONTAINER_DIE:    "docker_event_die",
+	CONTAINER_START:         "docker_event_start",
+	CONTAINER_CREATE:        "docker_event_create",
+	CONTAINER_DIE:           "docker_event_die",
+	CONTAINER_STOP:          "docker_event_stop",
+	CONTAINER_KILL:          "docker_event_kill",
+	CONTAINER_OOM:           "docker_event_oom",
+	CONTAINER_RESTART:       "docker_event_restart",
+	CONTAINER_DESTROY:       "docker_event_destroy",
+	CONTAINER_PAUSE:         "docker_event_pause",
+	CONTAINER_UNPAUSE:       "docker_event_unpause",
+	CONTAINER_HEALTH_STATUS: "docker_event_health_status",
+
+	IMAGE_PULL:   "docker_event_image_pull",
+	IMAGE_DELETE: "docker_event_image_delete",
+
+	NETWORK_CONNECT:    "docker_event_network_connect",
+	NETWORK_DISCONNECT: "docker_event_network_disconnect",
+
+	DAEMON_DISCONNECTED: "daemon_disconnected",
+	DAEMON_RECONNECTED:  "daemon_reconnected",
 }
 
+const (
+	RPC_EVENT_RECONCILE_RESULT = "reconcile_result"
+	RPC_EVENT_RECONCILE_DRIFT  = "reconcile_drift"
+)
+
+// type of the published messages, every class is published on its own topic
+const (
+	MESSAGE_TYPE_RESPONSE  = "response"
+	MESSAGE_TYPE_EVENT     = "event"
+	MESSAGE_TYPE_HEARTBEAT = "heartbeat"
+)
+
+const (
+	PRESENCE_ONLINE  = "online"
+	PRESENCE_OFFLINE = "offline"
+)
+
 const (
 	RPC_METHOD_START_DOCKER = "start_docker"
 	RPC_METHOD_ERROR_DOCKER = "error_docker"
 	RPC_METHOD_STOP_DOCKER  = "stop_docker"
+
+	RPC_METHOD_RESTART_DOCKER = "restart_docker"
+	RPC_METHOD_PAUSE_DOCKER   = "pause_docker"
+	RPC_METHOD_UNPAUSE_DOCKER = "unpause_docker"
+	RPC_METHOD_KILL_DOCKER    = "kill_docker"
+	RPC_METHOD_REMOVE_DOCKER  = "remove_docker"
+
+	RPC_METHOD_LIST_CONTAINERS   = "list_containers"
+	RPC_METHOD_INSPECT_CONTAINER = "inspect_container"
+
+	RPC_METHOD_LOGS_DOCKER = "logs_docker"
+	RPC_METHOD_CANCEL_LOGS = "cancel_logs"
+
+	RPC_METHOD_EXEC_DOCKER = "exec_docker"
+	RPC_METHOD_CANCEL_EXEC = "cancel_exec"
+
+	RPC_METHOD_STATS_DOCKER = "stats_docker"
+
+	RPC_METHOD_PULL_IMAGE   = "pull_image"
+	RPC_METHOD_LIST_IMAGES  = "list_images"
+	RPC_METHOD_REMOVE_IMAGE = "remove_image"
+	RPC_METHOD_PRUNE_IMAGES = "prune_images"
+
+	RPC_METHOD_SET_DESIRED_STATE = "set_desired_state"
+	RPC_METHOD_GET_DESIRED_STATE = "get_desired_state"
+
+	RPC_METHOD_DEPLOY_STACK = "deploy_stack"
+	RPC_METHOD_REMOVE_STACK = "remove_stack"
+	RPC_METHOD_STACK_STATUS = "stack_status"
 )
 
 const (
@@ -32,6 +120,13 @@ const (
 	RPC_ERR_CODE_INVALID_PARAMETERS     = -32602
 	RCP_ERR_CODE_INTERNAL_ERROR         = -32603
 	RPC_ERR_CODE_DOCKER_IMAGE_NOT_FOUND = -32604
+	RPC_ERR_CODE_CONTAINER_NOT_FOUND    = -32605
+	RPC_ERR_CODE_STREAM_NOT_FOUND       = -32606
+	RPC_ERR_CODE_CONTAINER_NOT_RUNNING  = -32607
+	RPC_ERR_CODE_REGISTRY_AUTH          = -32608
+	RPC_ERR_CODE_IMAGE_PULL_FAILED      = -32609
+	RPC_ERR_CODE_CONTAINER_NOT_MANAGED  = -32610
+	RPC_ERR_CODE_CONTAINER_UNHEALTHY    = -32611
 )
 
 type RpcReq struct {
@@ -39,18 +134,23 @@ type RpcReq struct {
 	Id      int         `json:"id"`
 	Method  string      `json:"method"`
 	Params  interface{} `json:"params"`
+
+	respond func(*RpcResp) //set by HandleRpcCallAsync
 }
 
 type RpcErr struct {
-	Error string `json:"error"`
-	Code  int    `json:"code"`
+	Error string      `json:"error"`
+	Code  int         `json:"code"`
+	Data  interface{} `json:"data,omitempty"` //additional information, e.g. partial results
 }
 
 type RpcResp struct {
-	Jsonrpc string      `json:"jsonrpc"`
-	Id      int         `json:"id"`
-	Result  interface{} `json:"result,omitempty"`
-	Error   *RpcErr     `json:"error,omitempty"`
+	Jsonrpc    string      `json:"jsonrpc"`
+	Id         int         `json:"id"`
+	Result     interface{} `json:"result,omitempty"`
+	Error      *RpcErr     `json:"error,omitempty"`
+	InstanceId string      `json:"instanceId,omitempty"` //answering instance, needed to aggregate broadcast responses
+	Type       string      `json:"type,omitempty"`       //always response
 }
 
 type RpcStartDockerParams struct {
@@ -58,34 +158,393 @@ type RpcStartDockerParams struct {
 	ContainerName string `json:"containerName"`
 	Restart       string `json:"restart,omitempty"`
 	User          string `json:"user,omitempty"`
+	PullPolicy    string `json:"pullPolicy,omitempty"` //always, if-not-present or never (default)
 	// GitUrl        string   `json:"gitUrl,omitempty"`
 	// GitBranch     string   `json:"gitBranch,omitempty"`
 	Environment []string `json:"environment,omitempty"`
 	Ports       []string `json:"ports,omitempty"`
-	Volumes     []string `json:"volumes,omitempty"`
+	Volumes     []string `json:"volumes,omitempty"` //absoluteHostPath:containerPath[:ro|rw]
 	Commands    []string `json:"commands,omitempty"`
+
+	//credentials for the registry of the image, overrides the agents configuration
+	RegistryAuth *RpcRegistryAuth `json:"registryAuth,omitempty"`
+
+	//resource limits, sizes are given as number of bytes or with unit (e.g. 512m, 1g)
+	Memory     string      `json:"memory,omitempty"`
+	MemorySwap string      `json:"memorySwap,omitempty"` //memory + swap, -1 for unlimited swap
+	CpuShares  int64       `json:"cpuShares,omitempty"`
+	CpuPeriod  int64       `json:"cpuPeriod,omitempty"`
+	CpuQuota   int64       `json:"cpuQuota,omitempty"`
+	Cpus       float64     `json:"cpus,omitempty"` //number of cpus, e.g. 1.5
+	CpusetCpus string      `json:"cpusetCpus,omitempty"`
+	PidsLimit  *int64      `json:"pidsLimit,omitempty"`
+	Ulimits    []RpcUlimit `json:"ulimits,omitempty"`
+	ShmSize    string      `json:"shmSize,omitempty"`
+
+	//security options
+	ReadOnly        bool              `json:"readOnly,omitempty"` //read-only root filesystem
+	CapAdd          []string          `json:"capAdd,omitempty"`
+	CapDrop         []string          `json:"capDrop,omitempty"`
+	NoNewPrivileges bool              `json:"noNewPrivileges,omitempty"`
+	Tmpfs           map[string]string `json:"tmpfs,omitempty"` //container path -> mount options
+
+	Healthcheck *RpcHealthcheck `json:"healthcheck,omitempty"`
+	WaitHealthy bool            `json:"waitHealthy,omitempty"` //return after the container reports healthy
+	WaitTimeout int             `json:"waitTimeout,omitempty"` //seconds to wait for healthy, default 60
+}
+
+// durations are given as go duration (e.g. 30s, 1m), empty values inherit the
+// settings of the image
+type RpcHealthcheck struct {
+	Test        []string `json:"test"` //["CMD", args...], ["CMD-SHELL", command] or ["NONE"]
+	Interval    string   `json:"interval,omitempty"`
+	Timeout     string   `json:"timeout,omitempty"`
+	StartPeriod string   `json:"startPeriod,omitempty"`
+	Retries     int      `json:"retries,omitempty"`
+}
+
+type RpcUlimit struct {
+	Name string `json:"name"`
+	Soft int64  `json:"soft"`
+	Hard int64  `json:"hard"`
+}
+
+type RpcRegistryAuth struct {
+	Server        string `json:"server,omitempty"` //defaults to the registry of the image
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identityToken,omitempty"`
 }
 
 type StartDockerResult struct {
 	ContainerId string   `json:"containerId"`
 	Warnings    []string `json:"warnings"`
+	Health      string   `json:"health,omitempty"` //health status if waitHealthy was set
+}
+
+type RpcStopDockerParams struct {
+	ContainerName string `json:"containerName"`
+	Timeout       *int   `json:"timeout,omitempty"` //seconds to wait before the container is killed
+	Signal        string `json:"signal,omitempty"`  //stop signal, default SIGTERM
+	Remove        bool   `json:"remove,omitempty"`  //remove the container once it is stopped
+}
+
+type StopDockerResult struct {
+	ContainerId string `json:"containerId"`
+	Stopped     bool   `json:"stopped"`
+	Removed     bool   `json:"removed"`
+}
+
+type RpcContainerParams struct {
+	ContainerName string `json:"containerName"`
+}
+
+type RpcRestartDockerParams struct {
+	ContainerName string `json:"containerName"`
+	Timeout       *int   `json:"timeout,omitempty"`
+	Signal        string `json:"signal,omitempty"`
+}
+
+type RpcKillDockerParams struct {
+	ContainerName string `json:"containerName"`
+	Signal        string `json:"signal,omitempty"` //default SIGKILL
+}
+
+type RpcRemoveDockerParams struct {
+	ContainerName string `json:"containerName"`
+	Force         bool   `json:"force,omitempty"`         //kill the container if it is running
+	RemoveVolumes bool   `json:"removeVolumes,omitempty"` //remove anonymous volumes of the container
+}
+
+// result of the lifecycle methods, State is the docker state of the container
+// after the operation or "removed" if the container does not exist anymore
+type ContainerStateResult struct {
+	ContainerId string `json:"containerId"`
+	State       string `json:"state"`
+}
+
+type RpcListContainersParams struct {
+	Labels []string `json:"labels,omitempty"` //label or label=value
+	Name   string   `json:"name,omitempty"`
+	Image  string   `json:"image,omitempty"`
+	State  string   `json:"state,omitempty"`
+}
+
+type ContainerListEntry struct {
+	ContainerId string            `json:"containerId"`
+	Names       []string          `json:"names"`
+	Image       string            `json:"image"`
+	State       string            `json:"state"`
+	Status      string            `json:"status"`
+	Ports       []string          `json:"ports"`
+	Labels      map[string]string `json:"labels"`
+	Created     time.Time         `json:"created"`
+}
+
+type ListContainersResult struct {
+	Containers []ContainerListEntry `json:"containers"`
+}
+
+type RpcLogsDockerParams struct {
+	ContainerName string `json:"containerName"`
+	Tail          string `json:"tail,omitempty"`  //number of lines from the end or "all" (default)
+	Since         string `json:"since,omitempty"` //unix timestamp, RFC3339 date or duration (e.g. 10m)
+	Until         string `json:"until,omitempty"`
+	Follow        bool   `json:"follow,omitempty"`
+	StreamId      string `json:"streamId,omitempty"` //id of the stream topic, generated if empty
+}
+
+type RpcCancelStreamParams struct {
+	StreamId string `json:"streamId"`
+}
+
+// returned by methods which publish their output on a dedicated topic
+type StreamResult struct {
+	StreamId string `json:"streamId"`
+	Topic    string `json:"topic"`
+}
+
+// published on the stream topic for every log line. The last message of a stream
+// has Eof set and carries the error if the stream failed
+type LogsStreamMessage struct {
+	StreamId  string    `json:"streamId"`
+	Stream    string    `json:"stream,omitempty"` //stdout or stderr
+	Timestamp time.Time `json:"timestamp,omitempty"`
+	Line      string    `json:"line,omitempty"`
+	Eof       bool      `json:"eof,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type RpcExecDockerParams struct {
+	ContainerName string   `json:"containerName"`
+	Cmd           []string `json:"cmd"`
+	User          string   `json:"user,omitempty"`
+	Env           []string `json:"env,omitempty"`
+	WorkingDir    string   `json:"workingDir,omitempty"`
+	Timeout       int      `json:"timeout,omitempty"`  //seconds, default 60. Not used in stream mode
+	Stream        bool     `json:"stream,omitempty"`   //publish the output on a stream topic
+	StreamId      string   `json:"streamId,omitempty"` //id of the stream topic, generated if empty
+}
+
+type ExecDockerResult struct {
+	ExitCode  int    `json:"exitCode"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Truncated bool   `json:"truncated,omitempty"` //output was longer than the capture limit
+}
+
+// published on the stream topic for every output chunk of a streamed exec. The last
+// message has Eof set and carries the exit code or the error
+type ExecStreamMessage struct {
+	StreamId string `json:"streamId"`
+	Stream   string `json:"stream,omitempty"` //stdout or stderr
+	Data     string `json:"data,omitempty"`
+	Eof      bool   `json:"eof,omitempty"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type RpcStatsDockerParams struct {
+	ContainerName string `json:"containerName,omitempty"` //empty returns the stats of all running managed containers
+}
+
+type StatsDockerResult struct {
+	Containers []*docker.ContainerStatsData `json:"containers"`
+}
+
+type RpcImageParams struct {
+	ImageName string `json:"imageName"`
+}
+
+type RpcPullImageParams struct {
+	ImageName    string           `json:"imageName"`
+	RegistryAuth *RpcRegistryAuth `json:"registryAuth,omitempty"`
+	StreamId     string           `json:"streamId,omitempty"` //id of the stream topic, generated if empty
+}
+
+type RpcRemoveImageParams struct {
+	ImageName     string `json:"imageName"`
+	Force         bool   `json:"force,omitempty"`
+	PruneChildren bool   `json:"pruneChildren,omitempty"`
+}
+
+type RpcPruneImagesParams struct {
+	All    bool     `json:"all,omitempty"`    //remove all unused images, not only dangling ones
+	Labels []string `json:"labels,omitempty"` //only prune images with these labels
+}
+
+type ListImagesResult struct {
+	Images []docker.ImageInfo `json:"images"`
+}
+
+// published on the stream topic while an image is pulled. The last message has
+// Eof set and carries the digest of the image or the error
+type PullImageStreamMessage struct {
+	StreamId string `json:"streamId"`
+	Layer    string `json:"layer,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Current  int64  `json:"current,omitempty"`
+	Total    int64  `json:"total,omitempty"`
+	Eof      bool   `json:"eof,omitempty"`
+	Digest   string `json:"digest,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Code     int    `json:"code,omitempty"` //rpc error code if the pull failed
+}
+
+// list of containers which should run on the instance
+type DesiredState struct {
+	Containers []RpcStartDockerParams `json:"containers"`
+}
+
+type SetDesiredStateResult struct {
+	Containers int `json:"containers"`
+}
+
+type ReconcileResult struct {
+	Created   []string         `json:"created"`
+	Recreated []string         `json:"recreated"`
+	Started   []string         `json:"started"`
+	Removed   []string         `json:"removed"`
+	Errors    []ReconcileError `json:"errors"`
+}
+
+type ReconcileError struct {
+	ContainerName string `json:"containerName"`
+	Error         string `json:"error"`
+}
+
+type ReconcileDrift struct {
+	ContainerName string `json:"containerName"`
+	ContainerId   string `json:"containerId"`
+	Reason        string `json:"reason"`
+}
+
+type RpcDeployStackParams struct {
+	Name    string           `json:"name"`
+	Compose string           `json:"compose,omitempty"` //stack definition as yaml or json text
+	Stack   *StackDefinition `json:"stack,omitempty"`   //stack definition as object
+}
+
+type RpcStackParams struct {
+	Name string `json:"name"`
+}
+
+type RpcRemoveStackParams struct {
+	Name          string `json:"name"`
+	RemoveVolumes bool   `json:"removeVolumes,omitempty"`
+}
+
+// compose-like stack definition. Networks and volumes only declare the names, their
+// options are ignored
+type StackDefinition struct {
+	Services map[string]StackServiceDefinition `json:"services" yaml:"services"`
+	Networks map[string]interface{}            `json:"networks,omitempty" yaml:"networks,omitempty"`
+	Volumes  map[string]interface{}            `json:"volumes,omitempty" yaml:"volumes,omitempty"`
+}
+
+type StackServiceDefinition struct {
+	Image       string           `json:"image" yaml:"image"`
+	User        string           `json:"user,omitempty" yaml:"user,omitempty"`
+	Restart     string           `json:"restart,omitempty" yaml:"restart,omitempty"`
+	PullPolicy  string           `json:"pull_policy,omitempty" yaml:"pull_policy,omitempty"`
+	Ports       []string         `json:"ports,omitempty" yaml:"ports,omitempty"` //[ip:]host:container like compose
+	Volumes     []string         `json:"volumes,omitempty" yaml:"volumes,omitempty"`
+	Environment StackEnvironment `json:"environment,omitempty" yaml:"environment,omitempty"`
+	Command     StackCommand     `json:"command,omitempty" yaml:"command,omitempty"`
+	DependsOn   StackDependsOn   `json:"depends_on,omitempty" yaml:"depends_on,omitempty"`
+	Networks    []string         `json:"networks,omitempty" yaml:"networks,omitempty"`
+}
+
+type StackResult struct {
+	Name     string                      `json:"name"`
+	Services []docker.StackServiceStatus `json:"services"`
+}
+
+type RemoveStackResult struct {
+	Name    string   `json:"name"`
+	Removed []string `json:"removed"`
+}
+
+// envelope of the messages published on the event topic
+type EventMessage struct {
+	Type       string      `json:"type"`  //always event
+	Event      string      `json:"event"` //e.g. docker_event_start (see EventMapping), daemon_disconnected or reconcile_result
+	InstanceId string      `json:"instanceId"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Data       interface{} `json:"data"`
+}
+
+// envelope of the messages published on the heartbeat topic
+type HeartbeatMessage struct {
+	Type         string             `json:"type"` //always heartbeat
+	InstanceId   string             `json:"instanceId"`
+	Timestamp    time.Time          `json:"timestamp"`
+	AgentVersion string             `json:"agentVersion"`
+	Hostinfo     interface{}        `json:"hostinfo"`
+	Host         *utils.HostMetrics `json:"host,omitempty"`
+	Docker       *HeartbeatDocker   `json:"docker,omitempty"`
+	Outbox       interface{}        `json:"outbox,omitempty"` //queued, dropped and replayed messages if the outbox is enabled
+	Errors       []string           `json:"errors,omitempty"` //metrics which could not be collected
+}
+
+type HeartbeatDocker struct {
+	EngineVersion string           `json:"engineVersion"`
+	DataRoot      string           `json:"dataRoot"`
+	Disk          *utils.DiskUsage `json:"disk,omitempty"` //usage of the file system of the data root or heartbeat_disk_path
+	Containers    map[string]int   `json:"containers"`     //managed containers by state
+}
+
+// retained status message of an instance, the offline message is the last will
+type PresenceMessage struct {
+	Status     string      `json:"status"`
+	InstanceId string      `json:"instanceId"`
+	Hostinfo   interface{} `json:"hostinfo,omitempty"`
 }
 
 type RpcHandler func(req *RpcReq) *RpcResp
 
+// publishes a payload on the given mqtt topic
+type Publisher func(topic string, payload []byte)
+
 type Rpc struct {
 	handlerMap map[string]RpcHandler
 	logger     utils.Logger
 	// dockerImgWhiteList []string
 	dockerClient *docker.Docker
+	managedOnly  bool   //only allow access to containers created by the agent
+	instanceId   string //added to every response
+	agentVersion string
+
+	hostMetrics utils.HostMetricsCollector
+	diskPath    string //disk usage reported in the heartbeat, default the docker data root
+
+	publish      Publisher
+	publishEvent func(event *EventMessage)
+	topics       *utils.Topics
+
+	streamLock sync.Mutex
+	streams    map[string]context.CancelFunc
+
+	desiredLock      sync.Mutex
+	desiredState     *DesiredState
+	desiredStateFile string
+	reconcileTrigger chan struct{}
+
+	jobs chan func() //serial requests of HandleRpcCallAsync
 }
 
 type EventsDockerResult struct {
-	ContainerId string `json:"containerId"`
-	Name        string `json:"name"`
-	Image       string `json:"image"`
-	Status      string `json:"status"`
-	ExitCode    string `json:"exitCode,omitempty"`
+	Type        string            `json:"type"` //container, image or network
+	ContainerId string            `json:"containerId,omitempty"`
+	Name        string            `json:"name,omitempty"`
+	Image       string            `json:"image,omitempty"`
+	Status      string            `json:"status"`
+	Health      string            `json:"health,omitempty"`
+	ExitCode    string            `json:"exitCode,omitempty"`
+	Signal      string            `json:"signal,omitempty"`
+	Network     string            `json:"network,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Error       string            `json:"error,omitempty"`
 }
 
 // func (r *Rpc) Init(loggerMode string, dockerImgWhiteList []string, dockerClient *docker.Docker) {
@@ -95,13 +554,269 @@ func (r *Rpc) Init(loggerMode string, dockerClient *docker.Docker) {
 	r.logger.Init(loggerMode)
 	// r.dockerImgWhiteList = dockerImgWhiteList
 	r.dockerClient = dockerClient
+	r.streams = make(map[string]context.CancelFunc)
+	r.reconcileTrigger = make(chan struct{}, 1)
+	r.jobs = make(chan func(), RPC_MAX_QUEUED_JOBS)
+	go r.runJobs()
+}
+
+// restrict the container methods to containers labeled as managed by the agent
+func (r *Rpc) SetManagedOnly(managedOnly bool) {
+	r.managedOnly = managedOnly
+}
+
+// version of the agent reported in the heartbeat
+func (r *Rpc) SetAgentVersion(version string) {
+	r.agentVersion = version
+}
+
+// path the disk usage in the heartbeat is read from. The default is the data root of the
+// docker daemon, which is only correct if the agent runs directly on the host
+func (r *Rpc) SetHeartbeatDiskPath(path string) {
+	r.diskPath = path
+}
+
+// the instance id is added to every response so responses to broadcast and group
+// requests can be told apart
+func (r *Rpc) SetInstanceId(instanceId string) {
+	r.instanceId = instanceId
+}
+
+// set the publisher and topic layout used by methods which stream their output
+func (r *Rpc) SetPublisher(topics *utils.Topics, publish Publisher) {
+	r.topics = topics
+	r.publish = publish
+}
+
+// set the publisher of the reconciler events. Without it the events are sent with the
+// stream publisher and get lost while the broker is not reachable
+func (r *Rpc) SetEventPublisher(publish func(event *EventMessage)) {
+	r.publishEvent = publish
+}
+
+func (r *Rpc) emitEvent(event *EventMessage) {
+	if r.publishEvent != nil {
+		r.publishEvent(event)
+		return
+	}
+
+	r.publishJson(r.topic(utils.TOPIC_CHANNEL_EVENT), event)
+}
+
+func (r *Rpc) NewEvent(event string, data interface{}) *EventMessage {
+	return &EventMessage{
+		Type:       MESSAGE_TYPE_EVENT,
+		Event:      event,
+		InstanceId: r.instanceId,
+		Timestamp:  time.Now().UTC(),
+		Data:       data,
+	}
+}
+
+// topic of the channel, empty if no publisher is configured
+func (r *Rpc) topic(channel string) string {
+	if r.topics == nil {
+		return ""
+	}
+	return r.topics.Topic(channel)
+}
+
+func (r *Rpc) streamTopic(channel string, id string) string {
+	if r.topics == nil {
+		return ""
+	}
+	return r.topics.StreamTopic(channel, id)
 }
 
 func (r *Rpc) AddHandler(name string, handler RpcHandler) {
 	r.handlerMap[name] = handler
 }
 
+// convert the generic request parameters into the given params struct. On failure
+// the error response which should be returned to the caller is returned
+func parseParams(req *RpcReq, params interface{}) *RpcResp {
+	paramsJson, err := json.Marshal(req.Params)
+	if err != nil {
+		return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, "could not convert parameters (marshal)")
+	}
+
+	err = json.Unmarshal(paramsJson, params)
+	if err != nil {
+		return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, "could not convert parameters (unmarshal)")
+	}
+
+	return nil
+}
+
+// check the parameters and fill in the defaults
+func (p *RpcStartDockerParams) validate() error {
+	if p.ImageName == "" {
+		return errors.New("imageName is required")
+	}
+
+	//images are not pulled by default, its the callers responsibility to ensure they only
+	//call images available on the system or explicitly allow a pull
+	if p.PullPolicy == "" {
+		p.PullPolicy = docker.PULL_POLICY_NEVER
+	}
+
+	switch p.PullPolicy {
+	case docker.PULL_POLICY_ALWAYS, docker.PULL_POLICY_IF_NOT_PRESENT, docker.PULL_POLICY_NEVER:
+	default:
+		return fmt.Errorf("unknown pullPolicy %s", p.PullPolicy)
+	}
+
+	for name, size := range map[string]string{"memory": p.Memory, "memorySwap": p.MemorySwap, "shmSize": p.ShmSize} {
+		if _, err := parseSize(size); err != nil {
+			return fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+
+	if p.Cpus < 0 {
+		return errors.New("cpus must not be negative")
+	}
+
+	for _, volume := range p.Volumes {
+		if err := docker.ValidateVolume(volume, false); err != nil {
+			return err
+		}
+	}
+
+	if p.Healthcheck != nil {
+		if _, err := p.Healthcheck.toDocker(); err != nil {
+			return fmt.Errorf("invalid healthcheck: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// parse a size given as bytes or with unit (e.g. 512m). Empty is 0 and -1 is kept
+// as is because docker uses it for unlimited
+func parseSize(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+
+	if size == "-1" {
+		return -1, nil
+	}
+
+	return units.RAMInBytes(size)
+}
+
+func (p *RpcStartDockerParams) toSpec() *docker.ContainerSpec {
+	spec := &docker.ContainerSpec{
+		ImageName:     p.ImageName,
+		ContainerName: p.ContainerName,
+		User:          p.User,
+		Restart:       p.Restart,
+		Ip:            "", //ip address will not be used from docker start job as of know
+		PullPolicy:    p.PullPolicy,
+		Ports:         p.Ports,
+		Volumes:       p.Volumes,
+		Environment:   p.Environment,
+		Commands:      p.Commands,
+		Auth:          p.RegistryAuth.toDocker(),
+	}
+
+	//sizes were checked by validate
+	spec.Memory, _ = parseSize(p.Memory)
+	spec.MemorySwap, _ = parseSize(p.MemorySwap)
+	spec.ShmSize, _ = parseSize(p.ShmSize)
+
+	spec.CpuShares = p.CpuShares
+	spec.CpuPeriod = p.CpuPeriod
+	spec.CpuQuota = p.CpuQuota
+	spec.NanoCpus = int64(p.Cpus * 1e9)
+	spec.CpusetCpus = p.CpusetCpus
+	spec.PidsLimit = p.PidsLimit
+	for _, u := range p.Ulimits {
+		spec.Ulimits = append(spec.Ulimits, docker.Ulimit{Name: u.Name, Soft: u.Soft, Hard: u.Hard})
+	}
+
+	spec.ReadOnlyRootfs = p.ReadOnly
+	spec.CapAdd = p.CapAdd
+	spec.CapDrop = p.CapDrop
+	spec.NoNewPrivileges = p.NoNewPrivileges
+	spec.Tmpfs = p.Tmpfs
+
+	//durations were checked by validate
+	if p.Healthcheck != nil {
+		spec.Healthcheck, _ = p.Healthcheck.toDocker()
+	}
+
+	return spec
+}
+
+func (h *RpcHealthcheck) toDocker() (*docker.Healthcheck, error) {
+	healthcheck := &docker.Healthcheck{
+		Test:    h.Test,
+		Retries: h.Retries,
+	}
+
+	durations := []struct {
+		value string
+		dst   *time.Duration
+	}{
+		{h.Interval, &healthcheck.Interval},
+		{h.Timeout, &healthcheck.Timeout},
+		{h.StartPeriod, &healthcheck.StartPeriod},
+	}
+
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, err
+		}
+		*d.dst = duration
+	}
+
+	return healthcheck, nil
+}
+
+func (a *RpcRegistryAuth) toDocker() *docker.RegistryAuth {
+	if a == nil {
+		return nil
+	}
+
+	return &docker.RegistryAuth{
+		Server:        a.Server,
+		Username:      a.Username,
+		Password:      a.Password,
+		IdentityToken: a.IdentityToken,
+	}
+}
+
+func newErrResp(req *RpcReq, code int, msg string) *RpcResp {
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Error: &RpcErr{
+			Code:  code,
+			Error: msg,
+		},
+	}
+}
+
 func (r *Rpc) HandleRpcCall(req *RpcReq) *RpcResp {
+	return r.finishResp(r.handleRpcCall(req))
+}
+
+func (r *Rpc) finishResp(resp *RpcResp) *RpcResp {
+	if resp != nil {
+		resp.InstanceId = r.instanceId
+		resp.Type = MESSAGE_TYPE_RESPONSE
+	}
+
+	return resp
+}
+
+func (r *Rpc) handleRpcCall(req *RpcReq) *RpcResp {
 	// if len(req.Jsonrpc) <= 0 {
 	// 	return nil
 	// }
@@ -0,0 +1,411 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/thomaskhub/mqtt-docker-sdk/docker"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+// deploy a compose-like stack. The stack is either given as object or as yaml/json
+// text in compose
+func (r *Rpc) HandleDeployStack(req *RpcReq) *RpcResp {
+	return r.respondAsync(req, true, func() *RpcResp {
+		return r.deployStack(req)
+	})
+}
+
+func (r *Rpc) deployStack(req *RpcReq) *RpcResp {
+	startLock.Lock()
+	defer startLock.Unlock()
+
+	r.logger.Debug("Handle the deployment of a stack", zap.Any("request", req.Params))
+
+	params := &RpcDeployStackParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	if params.Name == "" {
+		return newErrResp(req, RPC_ERR_CODE_INVALID_PARAMETERS, "name is required")
+	}
+
+	definition := params.Stack
+	if params.Compose != "" {
+		definition = &StackDefinition{}
+		err := yaml.Unmarshal([]byte(params.Compose), definition)
+		if err != nil {
+			return newErrResp(req, RPC_ERR_CODE_INVALID_PARAMETERS, fmt.Sprintf("could not parse compose: %v", err))
+		}
+	}
+
+	if definition == nil || len(definition.Services) == 0 {
+		return newErrResp(req, RPC_ERR_CODE_INVALID_PARAMETERS, "stack has no services")
+	}
+
+	stack, err := definition.toStack(params.Name)
+	if err != nil {
+		return newErrResp(req, RPC_ERR_CODE_INVALID_PARAMETERS, err.Error())
+	}
+
+	services, err := r.dockerClient.StackDeploy(stack)
+	if err != nil && services == nil {
+		return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+	}
+
+	//json rpc does not allow result and error together, the partial result is the error data
+	if err != nil {
+		return &RpcResp{
+			Id:      req.Id,
+			Jsonrpc: "2.0",
+			Error: &RpcErr{
+				Code:  RCP_ERR_CODE_INTERNAL_ERROR,
+				Error: err.Error(),
+				Data: StackResult{
+					Name:     params.Name,
+					Services: services,
+				},
+			},
+		}
+	}
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result: StackResult{
+			Name:     params.Name,
+			Services: services,
+		},
+	}
+}
+
+func (r *Rpc) HandleRemoveStack(req *RpcReq) *RpcResp {
+	return r.respondAsync(req, true, func() *RpcResp {
+		return r.removeStack(req)
+	})
+}
+
+func (r *Rpc) removeStack(req *RpcReq) *RpcResp {
+	startLock.Lock()
+	defer startLock.Unlock()
+
+	params := &RpcRemoveStackParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	if params.Name == "" {
+		return newErrResp(req, RPC_ERR_CODE_INVALID_PARAMETERS, "name is required")
+	}
+
+	removed, err := r.dockerClient.StackRemove(params.Name, params.RemoveVolumes)
+	if err != nil {
+		return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+	}
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result: RemoveStackResult{
+			Name:    params.Name,
+			Removed: removed,
+		},
+	}
+}
+
+func (r *Rpc) HandleStackStatus(req *RpcReq) *RpcResp {
+	params := &RpcStackParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	if params.Name == "" {
+		return newErrResp(req, RPC_ERR_CODE_INVALID_PARAMETERS, "name is required")
+	}
+
+	services, err := r.dockerClient.StackStatus(params.Name)
+	if err != nil {
+		return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+	}
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result: StackResult{
+			Name:     params.Name,
+			Services: services,
+		},
+	}
+}
+
+func (s *StackDefinition) toStack(name string) (*docker.Stack, error) {
+	stack := &docker.Stack{
+		Name:     name,
+		Services: make(map[string]docker.StackService),
+		Networks: sortedKeys(s.Networks),
+		Volumes:  sortedKeys(s.Volumes),
+	}
+
+	for serviceName, service := range s.Services {
+		if service.Image == "" {
+			return nil, fmt.Errorf("service %s: image is required", serviceName)
+		}
+
+		for _, net := range service.Networks {
+			if _, ok := s.Networks[net]; !ok && net != docker.STACK_DEFAULT_NETWORK {
+				return nil, fmt.Errorf("service %s: network %s is not defined", serviceName, net)
+			}
+		}
+
+		params := RpcStartDockerParams{
+			ImageName:   service.Image,
+			Restart:     service.Restart,
+			User:        service.User,
+			PullPolicy:  service.PullPolicy,
+			Environment: service.Environment,
+			Commands:    service.Command,
+		}
+
+		//compose uses [ip:]host:container, start_docker container:host[:ip]
+		for _, port := range service.Ports {
+			params.Ports = append(params.Ports, composePort(port))
+		}
+
+		//like compose, sources which are not a path must be declared as stack volume.
+		//They are added after the validation which only accepts host paths
+		named := []string{}
+		for _, volume := range service.Volumes {
+			source, _, _ := strings.Cut(volume, ":")
+			if _, ok := s.Volumes[source]; ok {
+				if err := docker.ValidateVolume(volume, true); err != nil {
+					return nil, fmt.Errorf("service %s: %v", serviceName, err)
+				}
+				named = append(named, volume)
+				continue
+			}
+
+			if !strings.HasPrefix(source, "/") && !strings.HasPrefix(source, ".") {
+				return nil, fmt.Errorf("service %s: volume %s is not defined", serviceName, source)
+			}
+			params.Volumes = append(params.Volumes, volume)
+		}
+
+		if err := params.validate(); err != nil {
+			return nil, fmt.Errorf("service %s: %v", serviceName, err)
+		}
+
+		spec := params.toSpec()
+		spec.Volumes = append(spec.Volumes, named...)
+
+		stack.Services[serviceName] = docker.StackService{
+			Spec:      *spec,
+			DependsOn: service.DependsOn,
+			Networks:  service.Networks,
+		}
+	}
+
+	//dependency cycles and unknown services are errors of the definition
+	if _, err := docker.StackOrder(stack.Services); err != nil {
+		return nil, err
+	}
+
+	return stack, nil
+}
+
+// convert a compose port ([ip:]host:container or container) to the start_docker format
+// container:host[:ip]. IPv6 addresses may be given in brackets
+func composePort(port string) string {
+	idx := strings.LastIndex(port, ":")
+	if idx < 0 {
+		return port + ":"
+	}
+
+	container := port[idx+1:]
+	host := port[:idx]
+
+	idx = strings.LastIndex(host, ":")
+	if idx < 0 {
+		return container + ":" + host
+	}
+
+	ip := strings.TrimSuffix(strings.TrimPrefix(host[:idx], "["), "]")
+	return container + ":" + host[idx+1:] + ":" + ip
+}
+
+// command given as list or as string which is split like a shell would do (quotes
+// and backslash escapes, no variable expansion)
+type StackCommand []string
+
+func (c *StackCommand) UnmarshalJSON(data []byte) error {
+	list := []string{}
+	if err := json.Unmarshal(data, &list); err == nil {
+		*c = list
+		return nil
+	}
+
+	command := ""
+	if err := json.Unmarshal(data, &command); err != nil {
+		return err
+	}
+
+	return c.split(command)
+}
+
+func (c *StackCommand) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	list := []string{}
+	if err := unmarshal(&list); err == nil {
+		*c = list
+		return nil
+	}
+
+	command := ""
+	if err := unmarshal(&command); err != nil {
+		return err
+	}
+
+	return c.split(command)
+}
+
+func (c *StackCommand) split(command string) error {
+	args := []string{}
+	current := strings.Builder{}
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, ch := range command {
+		switch {
+		case escaped:
+			current.WriteRune(ch)
+			escaped = false
+		case ch == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			} else {
+				current.WriteRune(ch)
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+			inArg = true
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(ch)
+			inArg = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return fmt.Errorf("unterminated quote or escape in command %s", command)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	*c = args
+	return nil
+}
+
+// environment given as list of KEY=value or as map
+type StackEnvironment []string
+
+func (e *StackEnvironment) UnmarshalJSON(data []byte) error {
+	list := []string{}
+	if err := json.Unmarshal(data, &list); err == nil {
+		*e = list
+		return nil
+	}
+
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+
+	*e = envFromMap(m)
+	return nil
+}
+
+func (e *StackEnvironment) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	list := []string{}
+	if err := unmarshal(&list); err == nil {
+		*e = list
+		return nil
+	}
+
+	m := map[string]interface{}{}
+	if err := unmarshal(&m); err != nil {
+		return err
+	}
+
+	*e = envFromMap(m)
+	return nil
+}
+
+// dependencies given as list of service names or as map (conditions are ignored)
+type StackDependsOn []string
+
+func (d *StackDependsOn) UnmarshalJSON(data []byte) error {
+	list := []string{}
+	if err := json.Unmarshal(data, &list); err == nil {
+		*d = list
+		return nil
+	}
+
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+
+	*d = sortedKeys(m)
+	return nil
+}
+
+func (d *StackDependsOn) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	list := []string{}
+	if err := unmarshal(&list); err == nil {
+		*d = list
+		return nil
+	}
+
+	m := map[string]interface{}{}
+	if err := unmarshal(&m); err != nil {
+		return err
+	}
+
+	*d = sortedKeys(m)
+	return nil
+}
+
+func envFromMap(m map[string]interface{}) []string {
+	env := make([]string, 0, len(m))
+	for _, key := range sortedKeys(m) {
+		if m[key] == nil {
+			env = append(env, key)
+		} else {
+			env = append(env, fmt.Sprintf("%s=%v", key, m[key]))
+		}
+	}
+
+	return env
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
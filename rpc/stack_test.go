@@ -0,0 +1,243 @@
+package rpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestComposePort(t *testing.T) {
+	tests := []struct {
+		port string
+		want string
+	}{
+		{"80", "80:"},
+		{"8080:80", "80:8080"},
+		{"127.0.0.1:8080:80", "80:8080:127.0.0.1"},
+		{"[::1]:8080:80", "80:8080:::1"},
+		{"8053:53/udp", "53/udp:8053"},
+		{":80", "80:"},
+	}
+
+	for _, tt := range tests {
+		if got := composePort(tt.port); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestStackCommand(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    StackCommand
+		wantErr bool
+	}{
+		{`["nginx", "-g", "daemon off;"]`, StackCommand{"nginx", "-g", "daemon off;"}, false},
+		{`"nginx -g 'daemon off;'"`, StackCommand{"nginx", "-g", "daemon off;"}, false},
+		{`"sh -c \"echo a  b\""`, StackCommand{"sh", "-c", "echo a  b"}, false},
+		{`"echo a\\ b ''"`, StackCommand{"echo", "a b", ""}, false},
+		{`"  "`, StackCommand{}, false},
+		{`"echo 'a"`, nil, true},
+		{`"echo a\\"`, nil, true},
+	}
+
+	for _, tt := range tests {
+		var got StackCommand
+		err := json.Unmarshal([]byte(tt.json), &got)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.json, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.json, got, tt.want)
+		}
+
+		//json is valid yaml, both unmarshalers have to agree
+		var gotYaml StackCommand
+		err = yaml.Unmarshal([]byte(tt.json), &gotYaml)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("yaml %s: err = %v, wantErr %v", tt.json, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(gotYaml, tt.want) {
+			t.Errorf("yaml %s: got %q, want %q", tt.json, gotYaml, tt.want)
+		}
+	}
+
+	var got StackCommand
+	if err := json.Unmarshal([]byte(`42`), &got); err == nil {
+		t.Error("json number: expected error")
+	}
+}
+
+func TestStackEnvironment(t *testing.T) {
+	tests := []struct {
+		yaml string
+		want StackEnvironment
+	}{
+		{"[A=1, B=two]", StackEnvironment{"A=1", "B=two"}},
+		{"{B: two, A: 1, C: }", StackEnvironment{"A=1", "B=two", "C"}},
+		{"{ENABLED: true}", StackEnvironment{"ENABLED=true"}},
+	}
+
+	for _, tt := range tests {
+		var got StackEnvironment
+		if err := yaml.Unmarshal([]byte(tt.yaml), &got); err != nil {
+			t.Errorf("%s: %v", tt.yaml, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.yaml, got, tt.want)
+		}
+	}
+
+	var got StackEnvironment
+	if err := json.Unmarshal([]byte(`{"B": "two", "A": 1, "C": null}`), &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := (StackEnvironment{"A=1", "B=two", "C"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("json: got %q, want %q", got, want)
+	}
+}
+
+func TestStackDependsOn(t *testing.T) {
+	tests := []struct {
+		yaml string
+		want StackDependsOn
+	}{
+		{"[db, cache]", StackDependsOn{"db", "cache"}},
+		{"{db: {condition: service_healthy}, cache: {}}", StackDependsOn{"cache", "db"}},
+	}
+
+	for _, tt := range tests {
+		var got StackDependsOn
+		if err := yaml.Unmarshal([]byte(tt.yaml), &got); err != nil {
+			t.Errorf("%s: %v", tt.yaml, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.yaml, got, tt.want)
+		}
+
+		var gotJson StackDependsOn
+		if err := json.Unmarshal([]byte(toJson(t, tt.yaml)), &gotJson); err != nil {
+			t.Errorf("json %s: %v", tt.yaml, err)
+			continue
+		}
+		if !reflect.DeepEqual(gotJson, tt.want) {
+			t.Errorf("json %s: got %q, want %q", tt.yaml, gotJson, tt.want)
+		}
+	}
+}
+
+func TestStackDefinitionToStack(t *testing.T) {
+	tests := []struct {
+		name    string
+		compose string
+		wantErr string
+	}{
+		{"valid", `
+services:
+  web:
+    image: nginx
+    volumes: ["/srv/web:/usr/share/nginx/html:ro", "cache:/cache"]
+    depends_on: [api]
+  api:
+    image: api
+volumes:
+  cache: {}
+`, ""},
+		{"relative bind", `
+services:
+  web:
+    image: nginx
+    volumes: ["./html:/usr/share/nginx/html"]
+`, "must be absolute"},
+		{"undeclared volume", `
+services:
+  web:
+    image: nginx
+    volumes: ["cache:/cache"]
+`, "is not defined"},
+		{"unknown mode", `
+services:
+  web:
+    image: nginx
+    volumes: ["/srv/web:/html:z"]
+`, "unsupported mode"},
+		{"unknown dependency", `
+services:
+  web:
+    image: nginx
+    depends_on: [api]
+`, "unknown service"},
+		{"cycle", `
+services:
+  a:
+    image: nginx
+    depends_on: [b]
+  b:
+    image: nginx
+    depends_on: [a]
+`, "dependency cycle"},
+	}
+
+	for _, tt := range tests {
+		definition := &StackDefinition{}
+		if err := yaml.Unmarshal([]byte(tt.compose), definition); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		stack, err := definition.toStack("app")
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+				continue
+			}
+			web := stack.Services["web"].Spec
+			if want := []string{"/srv/web:/usr/share/nginx/html:ro", "cache:/cache"}; !reflect.DeepEqual(web.Volumes, want) {
+				t.Errorf("%s: volumes %v, want %v", tt.name, web.Volumes, want)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want %s", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func toJson(t *testing.T, yamlText string) string {
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(yamlText), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(convertYaml(v))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+// yaml.v2 decodes maps with interface keys which json can not encode
+func convertYaml(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, value := range v {
+			m[key.(string)] = convertYaml(value)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = convertYaml(v[i])
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,120 @@
+package rpc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/thomaskhub/mqtt-docker-sdk/docker"
+	"go.uber.org/zap"
+)
+
+// returns the resource usage of a single container or of all running containers
+// managed by the agent if no containerName is given
+func (r *Rpc) HandleStatsDocker(req *RpcReq) *RpcResp {
+	params := &RpcStatsDockerParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	if params.ContainerName != "" {
+		_, id, errResp := r.findContainer(req, params.ContainerName)
+		if errResp != nil {
+			return errResp
+		}
+
+		stats, err := r.dockerClient.ContainerStats(id)
+		if err != nil {
+			return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+		}
+
+		return &RpcResp{
+			Id:      req.Id,
+			Jsonrpc: "2.0",
+			Result: StatsDockerResult{
+				Containers: []*docker.ContainerStatsData{stats},
+			},
+		}
+	}
+
+	//collecting the stats of many containers takes a while
+	return r.respondAsync(req, false, func() *RpcResp {
+		stats, err := r.collectStats()
+		if err != nil {
+			return newErrResp(req, RCP_ERR_CODE_INTERNAL_ERROR, err.Error())
+		}
+
+		return &RpcResp{
+			Id:      req.Id,
+			Jsonrpc: "2.0",
+			Result: StatsDockerResult{
+				Containers: stats,
+			},
+		}
+	})
+}
+
+// publish the stats of all running managed containers on the topic every interval
+func (r *Rpc) PublishStats(topic string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	for {
+		<-ticker.C
+
+		stats, err := r.collectStats()
+		if err != nil {
+			r.logger.Error("could not collect container stats", zap.Error(err))
+			continue
+		}
+
+		r.publishJson(topic, StatsDockerResult{
+			Containers: stats,
+		})
+	}
+}
+
+// the stats of a container take about a second because docker samples twice, so
+// they are read in parallel
+const STATS_MAX_CONCURRENT = 8
+
+// stats of the running containers managed by the agent, containers started by other
+// tools are never included (the heartbeat counts the same containers)
+func (r *Rpc) collectStats() ([]*docker.ContainerStatsData, error) {
+	containers, err := r.dockerClient.ContainerList(docker.ContainerFilter{
+		State:  "running",
+		Labels: []string{docker.LABEL_MANAGED + "=true"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]*docker.ContainerStatsData, len(containers))
+	limit := make(chan struct{}, STATS_MAX_CONCURRENT)
+	wg := sync.WaitGroup{}
+
+	for i, c := range containers {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(i int, id string) {
+			defer wg.Done()
+			defer func() { <-limit }()
+
+			data, err := r.dockerClient.ContainerStats(id)
+			if err != nil {
+				//container might have stopped in the meantime
+				r.logger.Warn("could not get container stats", zap.String("container", id), zap.Error(err))
+				return
+			}
+			stats[i] = data
+		}(i, c.ID)
+	}
+	wg.Wait()
+
+	result := make([]*docker.ContainerStatsData, 0, len(stats))
+	for _, data := range stats {
+		if data != nil {
+			result = append(result, data)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,91 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+var streamCounter uint64
+
+// register a new stream for the request, kind is the topic channel of the stream.
+// Returns the id of the stream, the topic its output gets published on and the
+// context which is canceled when the stream is stopped
+//
+// Output published before the caller subscribed to the topic is lost, so callers which
+// need the complete output pass their own streamId and subscribe before the request
+func (r *Rpc) startStream(req *RpcReq, kind string, streamId string) (string, string, context.Context, *RpcResp) {
+	id := streamId
+	if id == "" {
+		id = fmt.Sprintf("%s-%d-%d", kind, req.Id, atomic.AddUint64(&streamCounter, 1))
+	} else if strings.ContainsAny(id, "/+#") {
+		return "", "", nil, newErrResp(req, RPC_ERR_CODE_INVALID_PARAMETERS, "streamId must not contain /, + or #")
+	}
+	topic := r.streamTopic(kind, id)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.streamLock.Lock()
+	if _, ok := r.streams[id]; ok {
+		r.streamLock.Unlock()
+		cancel()
+		return "", "", nil, newErrResp(req, RPC_ERR_CODE_INVALID_PARAMETERS, fmt.Sprintf("stream %s is already running", id))
+	}
+	r.streams[id] = cancel
+	r.streamLock.Unlock()
+
+	return id, topic, ctx, nil
+}
+
+// cancel the stream and remove it from the list of active streams. Returns false
+// if the stream does not exist (anymore)
+func (r *Rpc) stopStream(id string) bool {
+	r.streamLock.Lock()
+	cancel, ok := r.streams[id]
+	delete(r.streams, id)
+	r.streamLock.Unlock()
+
+	if ok {
+		cancel()
+	}
+
+	return ok
+}
+
+func (r *Rpc) publishJson(topic string, v interface{}) {
+	if r.publish == nil {
+		r.logger.Warn("no publisher configured, dropping message", zap.String("topic", topic))
+		return
+	}
+
+	payload, err := json.Marshal(v)
+	if err != nil {
+		r.logger.Error("could not marshal message", zap.String("topic", topic), zap.Error(err))
+		return
+	}
+
+	r.publish(topic, payload)
+}
+
+func (r *Rpc) HandleCancelStream(req *RpcReq) *RpcResp {
+	params := &RpcCancelStreamParams{}
+	if errResp := parseParams(req, params); errResp != nil {
+		return errResp
+	}
+
+	if !r.stopStream(params.StreamId) {
+		return newErrResp(req, RPC_ERR_CODE_STREAM_NOT_FOUND, fmt.Sprintf("stream %s not found", params.StreamId))
+	}
+
+	return &RpcResp{
+		Id:      req.Id,
+		Jsonrpc: "2.0",
+		Result: StreamResult{
+			StreamId: params.StreamId,
+		},
+	}
+}
@@ -9,14 +9,52 @@ import (
 )
 
 type Mqtt struct {
-	Broker               string `yaml:"broker"`    //url of the remote broker
-	ClientId             string `yaml:"client_id"` //client id to connect to remote broker
-	Username             string `yaml:"username"`  //username to connect to remote broker
-	Password             string `yaml:"password"`  //password to connect to remote broker
-	EnableHeartbeat      bool   `yaml:"enable_heartbeat"`
-	HeartBeatInterval    int    `yaml:"heartbeat_interval"`
-	BrokerPublishTopic   string `yaml:"broker_publish_topic"`
-	BrokerSubscribeTopic string `yaml:"broker_subscribe_topic"`
+	Broker               string            `yaml:"broker"`           //url of the remote broker
+	ClientId             string            `yaml:"client_id"`        //client id to connect to remote broker
+	Username             string            `yaml:"username"`         //username to connect to remote broker
+	Password             string            `yaml:"password"`         //password to connect to remote broker
+	ProtocolVersion      uint              `yaml:"protocol_version"` //3 (3.1), 4 (3.1.1, default) or 5
+	MessageExpiry        uint32            `yaml:"message_expiry"`   //seconds responses and events are kept by v5 brokers, 0 never expires
+	Tls                  Tls               `yaml:"tls"`
+	EnableHeartbeat      bool              `yaml:"enable_heartbeat"`
+	HeartBeatInterval    int               `yaml:"heartbeat_interval"`
+	HeartbeatDiskPath    string            `yaml:"heartbeat_disk_path"`    //disk usage reported in the heartbeat, default the docker data root
+	EnableStats          bool              `yaml:"enable_stats"`           //periodically publish container stats
+	StatsInterval        int               `yaml:"stats_interval"`         //seconds between two stats messages
+	OutboxDir            string            `yaml:"outbox_dir"`             //directory the offline outbox is stored in, empty keeps it in memory
+	OutboxMaxMessages    int               `yaml:"outbox_max_messages"`    //max queued messages while disconnected, 0 disables the outbox
+	OutboxOverflow       string            `yaml:"outbox_overflow"`        //drop-oldest (default) or drop-newest
+	Broadcast            bool              `yaml:"broadcast"`              //also handle requests sent to the broadcast topic
+	Groups               []string          `yaml:"groups"`                 //also handle requests sent to the topics of these groups
+	GroupFields          []string          `yaml:"group_fields"`           //hostinfo fields whose values are used as additional groups
+	Topics               map[string]string `yaml:"topics"`                 //topic template by channel, see utils.DefaultTopics
+	BrokerPublishTopic   string            `yaml:"broker_publish_topic"`   //deprecated, template of the response topic
+	BrokerSubscribeTopic string            `yaml:"broker_subscribe_topic"` //deprecated, template of the rpc topic
+}
+
+// topic templates by channel. The deprecated broker topics are used for the channels
+// they used to cover if these are not configured in topics
+func (m *Mqtt) TopicTemplates() map[string]string {
+	templates := make(map[string]string, len(m.Topics)+2)
+	if m.BrokerSubscribeTopic != "" {
+		templates[TOPIC_CHANNEL_RPC] = m.BrokerSubscribeTopic
+	}
+	if m.BrokerPublishTopic != "" {
+		templates[TOPIC_CHANNEL_RESPONSE] = m.BrokerPublishTopic
+	}
+	for channel, template := range m.Topics {
+		templates[channel] = template
+	}
+
+	return templates
+}
+
+type Tls struct {
+	CaFile     string `yaml:"ca_file"`     //CA bundle to verify the broker, system CAs if empty
+	CertFile   string `yaml:"cert_file"`   //client certificate for mutual tls
+	KeyFile    string `yaml:"key_file"`    //private key of the client certificate
+	ServerName string `yaml:"server_name"` //overrides the host name of the broker certificate
+	MinVersion string `yaml:"min_version"` //minimum tls version 1.0 - 1.3, default 1.2
 }
 
 type Docker struct {
@@ -24,6 +62,22 @@ type Docker struct {
 	NetworkId      string `yaml:"network_id"`
 	NetworkSubnet  string `yaml:"network_subnet"`
 	NetworkGateway string `yaml:"network_gateway"`
+
+	Registries []Registry `yaml:"registries"` //credentials for private registries
+
+	Events map[string][]string `yaml:"events"` //forwarded docker events by type, default all supported events
+
+	ManagedOnly bool `yaml:"managed_only"` //restrict the rpc methods to containers created by the agent
+
+	ReconcileInterval int    `yaml:"reconcile_interval"` //seconds between two reconcile runs of the desired state
+	DesiredStateFile  string `yaml:"desired_state_file"` //file the desired state is persisted in (optional)
+}
+
+type Registry struct {
+	Server        string `yaml:"server"` //registry host as used in the image name, docker.io for docker hub
+	Username      string `yaml:"username"`
+	Password      string `yaml:"password"`
+	IdentityToken string `yaml:"identity_token"`
 }
 type Config struct {
 	Docker  Docker `yaml:"docker"`
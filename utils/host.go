@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// live metrics of the host read from /proc
+type HostMetrics struct {
+	Uptime          float64    `json:"uptime"`      //seconds since boot
+	LoadAverage     [3]float64 `json:"loadAverage"` //1, 5 and 15 minutes
+	CpuCount        int        `json:"cpuCount"`
+	CpuPercent      float64    `json:"cpuPercent"` //usage of all cpus since the previous sample
+	MemoryTotal     uint64     `json:"memoryTotal"`
+	MemoryAvailable uint64     `json:"memoryAvailable"`
+	MemoryPercent   float64    `json:"memoryPercent"`
+}
+
+type DiskUsage struct {
+	Path        string  `json:"path"`
+	Total       uint64  `json:"total"`
+	Free        uint64  `json:"free"` //available for unprivileged users
+	Used        uint64  `json:"used"`
+	UsedPercent float64 `json:"usedPercent"`
+}
+
+// keeps the cpu counters of the previous sample, the cpu usage is computed from the
+// difference to it. The first sample returns the usage since boot
+type HostMetricsCollector struct {
+	lastIdle  uint64
+	lastTotal uint64
+}
+
+func (c *HostMetricsCollector) Collect() (*HostMetrics, error) {
+	metrics := &HostMetrics{
+		CpuCount: runtime.NumCPU(),
+	}
+
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 1 {
+		return nil, fmt.Errorf("unexpected format of /proc/uptime")
+	}
+	metrics.Uptime, err = strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return nil, err
+	}
+	fields = strings.Fields(string(data))
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("unexpected format of /proc/loadavg")
+	}
+	for i := 0; i < 3; i++ {
+		metrics.LoadAverage[i], err = strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	metrics.CpuPercent, err = c.cpuPercent()
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.MemoryTotal, metrics.MemoryAvailable, err = memory()
+	if err != nil {
+		return nil, err
+	}
+	if metrics.MemoryTotal > 0 {
+		metrics.MemoryPercent = float64(metrics.MemoryTotal-metrics.MemoryAvailable) / float64(metrics.MemoryTotal) * 100.0
+	}
+
+	return metrics, nil
+}
+
+// usage of all cpus from the first line of /proc/stat
+func (c *HostMetricsCollector) cpuPercent() (float64, error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return 0, err
+	}
+
+	line, _, _ := strings.Cut(string(data), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, fmt.Errorf("unexpected format of /proc/stat")
+	}
+
+	//user nice system idle iowait irq softirq steal, guest and guest_nice are
+	//already part of user and nice
+	values := fields[1:]
+	if len(values) > 8 {
+		values = values[:8]
+	}
+
+	var total, idle uint64
+	for i, field := range values {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		total += value
+		//idle and iowait
+		if i == 3 || i == 4 {
+			idle += value
+		}
+	}
+
+	totalDelta := total - c.lastTotal
+	idleDelta := idle - c.lastIdle
+	c.lastTotal = total
+	c.lastIdle = idle
+
+	if totalDelta == 0 {
+		return 0, nil
+	}
+
+	return float64(totalDelta-idleDelta) / float64(totalDelta) * 100.0, nil
+}
+
+// total and available memory in bytes from /proc/meminfo
+func memory() (uint64, uint64, error) {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var total, available, free, buffers, cached uint64
+	hasAvailable := false
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		//values are in kB
+		switch fields[0] {
+		case "MemTotal:":
+			total = value * 1024
+		case "MemAvailable:":
+			available = value * 1024
+			hasAvailable = true
+		case "MemFree:":
+			free = value * 1024
+		case "Buffers:":
+			buffers = value * 1024
+		case "Cached:":
+			cached = value * 1024
+		}
+	}
+
+	if total == 0 {
+		return 0, 0, fmt.Errorf("MemTotal not found in /proc/meminfo")
+	}
+
+	//MemAvailable is missing on kernels older than 3.14
+	if !hasAvailable {
+		available = free + buffers + cached
+	}
+
+	return total, available, nil
+}
+
+// usage of the file system the path is located on. The path is resolved in the file
+// system of the agent, which differs from the host if the agent runs in a container
+func GetDiskUsage(path string) (*DiskUsage, error) {
+	stat := syscall.Statfs_t{}
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &DiskUsage{
+		Path:  path,
+		Total: stat.Blocks * uint64(stat.Bsize),
+		Free:  stat.Bavail * uint64(stat.Bsize),
+		Used:  (stat.Blocks - stat.Bfree) * uint64(stat.Bsize),
+	}
+	if usage.Total > 0 {
+		usage.UsedPercent = float64(usage.Used) / float64(usage.Total) * 100.0
+	}
+
+	return usage, nil
+}
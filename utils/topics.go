@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// message classes which get their own topic
+const (
+	TOPIC_CHANNEL_RPC           = "rpc"           //requests to this instance (subscribed)
+	TOPIC_CHANNEL_BROADCAST     = "broadcast"     //requests to all instances (subscribed)
+	TOPIC_CHANNEL_GROUP         = "group"         //requests to a group of instances (subscribed)
+	TOPIC_CHANNEL_DESIRED_STATE = "desired_state" //desired state documents (subscribed)
+	TOPIC_CHANNEL_RESPONSE      = "response"      //json rpc responses (rpc.RpcResp)
+	TOPIC_CHANNEL_EVENT         = "event"         //docker and reconciler events (rpc.EventMessage)
+	TOPIC_CHANNEL_HEARTBEAT     = "heartbeat"     //periodic host status (rpc.HeartbeatMessage)
+	TOPIC_CHANNEL_STATUS        = "status"
+	TOPIC_CHANNEL_STATS         = "stats"
+	TOPIC_CHANNEL_LOGS          = "logs" //the stream id is appended to the topic
+	TOPIC_CHANNEL_EXEC          = "exec" //the stream id is appended to the topic
+	TOPIC_CHANNEL_PULL          = "pull" //the stream id is appended to the topic
+)
+
+// topic templates used if a channel is not configured. Placeholders:
+//
+//	{app}              app_name
+//	{instance}         instance_id of the host
+//	{channel}          name of the channel
+//	{group}            group name, only for the group channel
+//	{hostinfo.<field>} any field of the hostinfo
+var DefaultTopics = map[string]string{
+	TOPIC_CHANNEL_RPC:           "{app}/{instance}",
+	TOPIC_CHANNEL_BROADCAST:     "{app}/broadcast",
+	TOPIC_CHANNEL_GROUP:         "{app}/group/{group}",
+	TOPIC_CHANNEL_DESIRED_STATE: "{app}/{instance}/desired_state",
+	TOPIC_CHANNEL_RESPONSE:      "{app}/cmd/{instance}",
+	TOPIC_CHANNEL_EVENT:         "{app}/cmd/{instance}/event",
+	TOPIC_CHANNEL_HEARTBEAT:     "{app}/cmd/{instance}/heartbeat",
+	TOPIC_CHANNEL_STATUS:        "{app}/status/{instance}",
+	TOPIC_CHANNEL_STATS:         "{app}/cmd/{instance}/stats",
+	TOPIC_CHANNEL_LOGS:          "{app}/cmd/{instance}/logs",
+	TOPIC_CHANNEL_EXEC:          "{app}/cmd/{instance}/exec",
+	TOPIC_CHANNEL_PULL:          "{app}/cmd/{instance}/pull",
+}
+
+var topicPlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// resolved topic layout of the instance
+type Topics struct {
+	topics map[string]string //by channel, only {group} is left unresolved
+}
+
+// resolve the topic templates of all channels. templates overrides DefaultTopics per
+// channel, unknown channels and placeholders or missing hostinfo fields are an error
+func NewTopics(templates map[string]string, app string, instance string, hostinfo map[string]interface{}) (*Topics, error) {
+	t := &Topics{
+		topics: make(map[string]string, len(DefaultTopics)),
+	}
+
+	for channel := range templates {
+		if _, ok := DefaultTopics[channel]; !ok {
+			return nil, fmt.Errorf("unknown topic channel %s", channel)
+		}
+	}
+
+	for channel, template := range DefaultTopics {
+		if custom, ok := templates[channel]; ok && custom != "" {
+			template = custom
+		}
+
+		var err error
+		topic := topicPlaceholder.ReplaceAllStringFunc(template, func(match string) string {
+			name := match[1 : len(match)-1]
+
+			switch {
+			case name == "app":
+				return app
+			case name == "instance":
+				return instance
+			case name == "channel":
+				return channel
+			case name == "group" && channel == TOPIC_CHANNEL_GROUP:
+				return match
+			case strings.HasPrefix(name, "hostinfo."):
+				field := strings.TrimPrefix(name, "hostinfo.")
+				value, ok := hostinfo[field]
+				if !ok || value == nil {
+					err = fmt.Errorf("hostinfo field %s used in topic %s not found", field, template)
+					return ""
+				}
+				return fmt.Sprint(value)
+			}
+
+			err = fmt.Errorf("unknown placeholder %s in topic %s", match, template)
+			return ""
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.ContainsAny(topic, "+#") || topic == "" {
+			return nil, fmt.Errorf("invalid topic %s for channel %s", topic, channel)
+		}
+
+		//braces left over are unclosed placeholders
+		if strings.ContainsAny(strings.ReplaceAll(topic, "{group}", ""), "{}") {
+			return nil, fmt.Errorf("unclosed placeholder in topic %s", template)
+		}
+
+		t.topics[channel] = topic
+	}
+
+	return t, nil
+}
+
+// topic of the channel
+func (t *Topics) Topic(channel string) string {
+	return t.topics[channel]
+}
+
+// topic of the channel with the stream id appended
+func (t *Topics) StreamTopic(channel string, id string) string {
+	return t.topics[channel] + "/" + id
+}
+
+// topic of a group, requests to the group are received on this topic
+func (t *Topics) GroupTopic(group string) string {
+	return strings.ReplaceAll(t.topics[TOPIC_CHANNEL_GROUP], "{group}", group)
+}
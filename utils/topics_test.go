@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewTopics(t *testing.T) {
+	hostinfo := map[string]interface{}{
+		"site":   "berlin",
+		"rack":   7,
+		"empty":  nil,
+		"region": "eu/+",
+	}
+
+	tests := []struct {
+		name      string
+		templates map[string]string
+		channel   string
+		want      string
+		wantErr   string
+	}{
+		{"default", nil, TOPIC_CHANNEL_RPC, "media/i-1", ""},
+		{"empty template uses default", map[string]string{TOPIC_CHANNEL_EVENT: ""}, TOPIC_CHANNEL_EVENT, "media/cmd/i-1/event", ""},
+		{"custom", map[string]string{TOPIC_CHANNEL_EVENT: "{app}/{hostinfo.site}/{instance}/{channel}"}, TOPIC_CHANNEL_EVENT, "media/berlin/i-1/event", ""},
+		{"number field", map[string]string{TOPIC_CHANNEL_RPC: "{app}/rack/{hostinfo.rack}"}, TOPIC_CHANNEL_RPC, "media/rack/7", ""},
+		{"group kept", nil, TOPIC_CHANNEL_GROUP, "media/group/{group}", ""},
+		{"no placeholder", map[string]string{TOPIC_CHANNEL_RPC: "fixed/topic"}, TOPIC_CHANNEL_RPC, "fixed/topic", ""},
+		{"unknown channel", map[string]string{"events": "x"}, "", "", "unknown topic channel"},
+		{"unknown placeholder", map[string]string{TOPIC_CHANNEL_RPC: "{app}/{host}"}, "", "", "unknown placeholder {host}"},
+		{"group outside group channel", map[string]string{TOPIC_CHANNEL_RPC: "{app}/{group}"}, "", "", "unknown placeholder {group}"},
+		{"missing hostinfo field", map[string]string{TOPIC_CHANNEL_RPC: "{hostinfo.role}"}, "", "", "hostinfo field role"},
+		{"nil hostinfo field", map[string]string{TOPIC_CHANNEL_RPC: "{hostinfo.empty}"}, "", "", "hostinfo field empty"},
+		{"wildcard from hostinfo", map[string]string{TOPIC_CHANNEL_RPC: "{app}/{hostinfo.region}"}, "", "", "invalid topic"},
+		{"wildcard in template", map[string]string{TOPIC_CHANNEL_RPC: "{app}/#"}, "", "", "invalid topic"},
+		{"unclosed placeholder", map[string]string{TOPIC_CHANNEL_RPC: "{app}/{instance"}, "", "", "unclosed placeholder"},
+	}
+
+	for _, tt := range tests {
+		topics, err := NewTopics(tt.templates, "media", "i-1", hostinfo)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %s", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		if got := topics.Topic(tt.channel); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTopicsStreamAndGroup(t *testing.T) {
+	topics, err := NewTopics(nil, "media", "i-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := topics.StreamTopic(TOPIC_CHANNEL_LOGS, "logs-1-1"), "media/cmd/i-1/logs/logs-1-1"; got != want {
+		t.Errorf("stream topic %s, want %s", got, want)
+	}
+
+	if got, want := topics.GroupTopic("edge"), "media/group/edge"; got != want {
+		t.Errorf("group topic %s, want %s", got, want)
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 
@@ -68,3 +69,30 @@ func GetHostInfoByteAndMap() ([]byte, map[string]interface{}, error) {
 
 	return data, m, nil
 }
+
+// yaml decodes nested maps as map[interface{}]interface{} which can not be encoded
+// as json, convert them to map[string]interface{}
+func JsonCompatible(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			m[fmt.Sprint(k)] = JsonCompatible(item)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			m[k] = JsonCompatible(item)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(value))
+		for i, item := range value {
+			l[i] = JsonCompatible(item)
+		}
+		return l
+	default:
+		return v
+	}
+}